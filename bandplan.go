@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/llgcode/draw2d/draw2dimg"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// bandPlanRows is how many rows of bands are stacked at the top of the spectrum when they overlap
+const bandPlanRows = 2
+
+const bandPlanRowHeight = 12
+
+// Band is an allocation of the band plan. A band without regions applies to all of them.
+type Band struct {
+	Name    string  `json:"name"`
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Color   string  `json:"color"`
+	Regions []int   `json:"regions"`
+
+	rgba color.NRGBA
+}
+
+type bandPlanFile struct {
+	Bands []Band `json:"bands"`
+}
+
+var bandPlan []Band
+var showBandPlan = true
+
+// bandPlanRegion is the ITU region, 1 is Europe and Africa, 2 the Americas and 3 Asia and Oceania
+var bandPlanRegion = 1
+
+var bandPlanRegionNames = []string{"ITU Region 1", "ITU Region 2", "ITU Region 3"}
+
+func init() {
+	var err error
+	bandPlan, err = ParseBandPlan(MustAsset("assets/bandplan.json"))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// userBandPlanPath is bandplan.json next to the settings, it replaces the bundled band plan
+func userBandPlanPath() (string, error) {
+	filename, err := settingsPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(filename), "bandplan.json"), nil
+}
+
+// LoadUserBandPlan replaces the bundled band plan by the user one when it exists
+func LoadUserBandPlan() error {
+	filename, err := userBandPlanPath()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	bands, err := ParseBandPlan(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	log.Printf("Loaded band plan from %s\n", filename)
+	bandPlan = bands
+	return nil
+}
+
+func ParseBandPlan(data []byte) ([]Band, error) {
+	var f bandPlanFile
+	err := json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, err
+	}
+	for i := range f.Bands {
+		var b = &f.Bands[i]
+		if b.End <= b.Start {
+			return nil, fmt.Errorf("band %s ends before it starts", b.Name)
+		}
+		b.rgba, err = parseHexColor(b.Color)
+		if err != nil {
+			return nil, fmt.Errorf("band %s: %s", b.Name, err)
+		}
+	}
+	sort.SliceStable(f.Bands, func(i, j int) bool {
+		return f.Bands[i].Start < f.Bands[j].Start
+	})
+	return f.Bands, nil
+}
+
+func (b Band) InRegion(region int) bool {
+	if len(b.Regions) == 0 {
+		return true
+	}
+	for _, r := range b.Regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// BandsAt returns the bands of the selected region containing frequency
+func BandsAt(frequency float64) []Band {
+	var bands = make([]Band, 0)
+	for _, b := range bandPlan {
+		if b.InRegion(bandPlanRegion) && frequency >= b.Start && frequency <= b.End {
+			bands = append(bands, b)
+		}
+	}
+	return bands
+}
+
+// drawBandPlan draws the bands of the visible span as coloured bars at the top of the spectrum
+func drawBandPlan(gc *draw2dimg.GraphicContext, img *image.RGBA, width int) {
+	if !showBandPlan {
+		return
+	}
+	gc.Save()
+	gc.SetFontSize(9)
+	var rowEnd = make([]float64, bandPlanRows)
+	for i := range rowEnd {
+		rowEnd[i] = math.Inf(-1)
+	}
+	for _, b := range bandPlan {
+		if !b.InRegion(bandPlanRegion) {
+			continue
+		}
+		var x0 = math.Max(0, math.Round(FrequencyToPixelX(b.Start, float64(width))))
+		var x1 = math.Min(float64(width), math.Round(FrequencyToPixelX(b.End, float64(width))))
+		if x1 <= 0 || x0 >= float64(width) {
+			continue
+		}
+		x1 = math.Max(x1, x0+1)
+
+		var row = 0
+		for row < bandPlanRows-1 && rowEnd[row] > x0 {
+			row++
+		}
+		rowEnd[row] = x1
+
+		var y = row * bandPlanRowHeight
+		var fill = b.rgba
+		fill.A = 96
+		draw.Draw(img, image.Rect(int(x0), y, int(x1), y+bandPlanRowHeight-1), &image.Uniform{C: fill}, image.ZP, draw.Over)
+
+		// Label centered on the visible part of the band, when it fits
+		var left, _, right, _ = gc.GetStringBounds(b.Name)
+		var labelWidth = right - left
+		if labelWidth+4 < x1-x0 {
+			gc.SetFillColor(color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+			gc.FillStringAt(b.Name, (x0+x1-labelWidth)/2, float64(y+bandPlanRowHeight-3))
+		}
+	}
+	gc.Restore()
+}
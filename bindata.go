@@ -4,6 +4,7 @@
 // assets/FreeSans.ttf (568.896kB)
 // assets/arrow_down.png (3.052kB)
 // assets/arrow_up.png (2.882kB)
+// assets/bandplan.json (3.854kB)
 // assets/play.png (566B)
 // assets/stop.png (520B)
 
@@ -154,6 +155,26 @@ func assetsArrow_upPng() (*asset, error) {
 	return a, nil
 }
 
+var _assetsBandplanJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xa5\x96\x4f\x8f\xda\x30\x10\xc5\xef\x7c\x0a\x2b\xbd\xd2\x76\xfc\xdf\xe9\x0d\x8a\x60\x2b\x91\x2d\x22\x52\xf7\x50\xed\xc1\x85\xb0\x8d\xca\x06\x29\x44\xad\xd4\xd5\x7e\xf7\x26\x2d\x48\xf1\xd8\x34\x21\x88\x93\x13\xf1\x7b\xe3\xe7\x99\x17\xbf\x8c\x08\x89\xbe\xd9\x62\x7b\x8c\x3e\x90\xaf\xf5\x82\x90\x97\xa8\xb0\xcf\x59\xbd\x8c\x96\x0f\x64\x5a\x1e\xec\x76\x63\x8f\x55\x34\x26\xd1\xb1\xb2\x65\x55\xbf\xa0\xc2\x48\x80\xfa\x41\x56\x6c\xeb\x25\x33\xfc\xdf\x72\x73\xd8\x1f\xca\xe6\x8f\x6f\x36\xa0\x41\x40\xf3\x9f\x32\x7b\xca\x0f\xc5\x5f\x3a\x7d\x7c\x1d\x23\x85\xe4\x82\x82\x64\xaa\xad\x40\x15\xa8\x7e\x12\x63\xc2\xaf\x51\xa9\xa1\x2d\x15\x0d\xa7\x75\x87\x0a\xf3\x25\xea\x0a\xc9\xb3\xe3\x91\xa1\xd0\x86\x33\x00\xc0\x70\x01\x16\x76\xbb\x6e\x97\x02\x70\x18\x06\x67\x41\x7f\x0c\xc2\x37\xc7\xd9\xc6\x73\x33\xbc\xf6\x2e\xb6\xe8\x5d\xfa\x80\xba\xe3\x9e\xec\x80\x27\xd8\x72\xc9\x25\x6d\xb7\xa4\xe4\xca\x6b\xc9\x13\xdb\x63\x09\xc4\xd2\xe0\xd6\xa9\x59\x5f\x7f\x83\xc7\xd7\x89\xe7\xc3\x2d\xe6\xb8\xf3\x80\xba\xf0\xfa\x81\xbc\x44\xf7\x68\x0c\xd3\x04\x2a\x95\x0a\xde\x9f\x46\xb5\x37\x15\xca\x38\x34\x43\xcf\x0f\x7a\xd0\xa4\x4b\x63\x14\xd5\xc6\xa8\xb8\xa2\x36\x86\x68\xc2\xc4\x2e\x4d\xc4\x71\x6f\xda\xc7\xa9\xc3\x52\xb1\x72\x82\x8b\x69\xe1\x27\x97\x85\xe6\x17\xa8\x0c\x9d\x01\x33\x78\x9f\xb1\x86\xde\x95\x29\x34\x25\x80\x60\xf2\x96\xdc\xeb\x84\x8b\xdb\x72\x4f\x04\xe7\xa6\x35\x38\x20\x87\x17\x3f\x4f\xc2\x1f\x1d\xa3\x25\x9e\x20\x13\xd8\xc6\x6e\x67\x9a\x0f\x8f\x87\x9d\x64\xe5\x81\xdc\xdb\x9f\xf9\x93\xad\x6a\x75\x77\x36\xf1\x51\x52\x1a\x42\x67\x90\x85\xd1\x79\xd9\xdc\x04\x1c\x24\xf5\x90\x5c\x07\xab\x0d\x23\x1f\x32\x5b\x7d\xcf\x4a\x92\xda\x2a\xdb\xef\xf3\x2a\x3b\x3a\x74\xae\x3d\x7a\xa8\x60\x0b\x2a\x1c\x27\x38\x4d\xfc\x38\x51\x37\xb4\x5f\x0f\xbc\xb9\xad\x01\x13\x5b\xe6\x45\x46\xbe\xdc\xcd\x1d\x21\xa9\xb0\x90\x62\xc0\xa4\x2f\x94\xc1\x26\x60\xfa\xfd\xe7\xc9\x84\x9c\x9c\x77\xb8\x8a\x09\x8f\x2b\xe5\x25\xbb\x3b\xbf\x0d\x1a\xc8\xc6\x71\x48\x70\x3c\x41\x67\xcb\x06\x7f\xdb\x7c\x0d\xe6\x69\x48\xb8\xe1\x0e\xb1\x5c\xcd\x04\xe7\xee\x2e\x38\x48\x57\x81\x0b\x1d\xc3\x85\x80\xed\x6c\xa3\x55\xb2\x16\x42\x39\x0a\x42\x79\x3e\x29\x06\x83\x15\xe6\xeb\x94\xbc\x27\x8b\x64\x9d\x3a\x2a\xad\xc3\x3d\xa9\x28\xad\x99\xec\xa5\x12\x70\x6a\x91\x26\xa4\x76\x81\xcc\x0e\xbf\x8a\x7d\x5e\xfc\x68\x6b\xc5\x4c\xa2\x1d\xc5\x0a\x82\x39\xa1\x02\x3b\x0a\x9e\xfc\x64\x96\xbe\x9d\xa2\x78\xf3\xe2\x02\x62\x7e\x45\x1a\x31\x8e\x9a\x89\x32\x01\x5e\x02\xc1\x7f\xda\xc9\x37\x65\x95\x92\x25\x45\xd3\xcb\x31\x53\x1a\x7d\x45\xac\x35\x46\x37\xb9\x1b\x74\xba\x7e\x81\xad\xa6\xc6\xdc\xe8\x35\xc5\xc6\xb0\xb6\x0b\xe7\x0b\x8b\xbc\xc6\x18\xf6\x4e\x90\xc5\xdd\x6f\xf2\x29\x4d\xdc\x7b\x90\x0f\x96\x41\xc7\x2f\xdd\x5f\x62\x54\x2a\xf7\x4b\xe5\x12\xe0\xba\x60\xae\x35\x1e\x47\xaf\xa3\x3f\xc6\x41\xc0\x1f\x0e\x0f\x00\x00")
+
+func assetsBandplanJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_assetsBandplanJson,
+		"assets/bandplan.json",
+	)
+}
+
+func assetsBandplanJson() (*asset, error) {
+	bytes, err := assetsBandplanJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "assets/bandplan.json", size: 3854, mode: os.FileMode(420), modTime: time.Unix(1792310125, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x31, 0x74, 0x2a, 0xfd, 0x9f, 0xef, 0x93, 0x46, 0xef, 0x16, 0x9, 0xac, 0x42, 0x9d, 0x39, 0x41, 0xde, 0x2f, 0x52, 0x71, 0xaf, 0x4, 0xf0, 0x15, 0xef, 0x55, 0x83, 0x78, 0x58, 0xb0, 0xd9, 0x2}}
+	return a, nil
+}
+
 var _assetsPlayPng = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xea\x0c\xf0\x73\xe7\xe5\x92\xe2\x62\x60\x60\xe0\xf5\xf4\x70\x09\x62\x60\x60\x68\x00\x61\x0e\x36\x06\x06\x86\xc3\x76\x89\xa7\x19\x18\x18\xd8\x92\xbc\xdd\x5d\x18\xfe\x83\xe0\x82\xbd\xcb\x27\x33\x30\x30\x70\x16\x78\x44\x16\x33\x30\x70\x0b\x83\x30\x23\xc3\xac\x39\x12\x0c\x0c\x0c\xec\x25\x9e\xbe\xae\xec\xf7\xb9\x45\xb8\xf9\x59\xb8\xb7\x1f\xda\xc2\xc0\xc0\x20\x9b\x19\x12\x51\xe2\x9c\x9f\x9b\x9b\x9a\x57\xc2\x00\x02\xce\x45\xa9\x89\x25\xa9\x29\x0a\xe5\x99\x25\x19\x0a\xee\x9e\xbe\x01\x29\x7a\xa9\xec\x0c\x0c\x8c\xb3\x3c\x5d\x1c\x43\x2a\x6e\xbd\xbd\x7b\xb1\xb7\xd9\x40\x84\x35\x50\x78\xa9\xa3\xd6\xd2\x23\x17\x1c\x5d\x54\x9e\x28\x9c\x9f\x29\x34\xe3\xe6\x6f\x9d\xa7\xc9\xc7\x19\x10\xe0\x81\x5c\xdf\xe3\x1f\x3f\xb8\xce\x27\xfc\xde\xfe\xa5\xf6\xbe\xb9\x94\x18\xff\x83\x53\xf1\x7b\x04\xc4\x78\x1f\x5c\xdf\x29\x7e\x28\x26\xee\x1e\xbb\xd8\x83\x8d\x4e\x6b\x1d\x6d\x18\x14\x59\xfc\x1b\x36\x27\x30\xae\x69\x64\x68\x51\x60\x50\xac\x60\xae\x90\x8f\x60\xc8\x56\x60\x50\xb4\x60\x3c\xd7\xc4\xba\x81\x8d\x49\xa0\x49\xf8\x81\x0e\x1e\x21\xa5\x6d\x0c\xd7\x1c\x18\x9c\x0a\x98\xe6\xb0\x72\x27\xf0\xb2\x28\xb0\x30\x72\x1c\x94\x3e\xf0\xfb\x00\x53\x04\x33\x23\xc7\x41\xce\x02\x31\x9d\x06\x53\x81\x06\x81\x39\x0c\xe9\x07\xe1\x42\x2c\x0a\x4c\x8c\x4f\x94\x05\x1c\x6c\x98\x18\x8f\x08\x36\x30\x28\x30\x70\x30\x30\x81\x28\x9b\x36\xc9\xfd\xdc\x1c\x0a\x3a\xf1\x0c\x85\x3f\x99\x3a\x4e\xcb\x27\xf7\x6c\xf7\xbf\x27\xa2\xdf\xb0\xa3\x42\xbd\xa1\x86\x3b\x40\x0c\x95\xc5\x78\xe4\x68\x35\xf3\x84\x7c\xc6\x53\x8f\x58\x05\xc4\xdf\xb3\x10\x60\xdd\x8f\x65\x78\xb4\x98\x51\x40\xde\x8e\xf1\x89\xbb\x78\xc3\x8f\x0c\x86\x23\xed\xfe\x0c\x3f\x2f\xb2\x2a\xd8\x49\x31\x7c\x7c\x28\xec\x50\x57\xc2\xd8\xd1\xcf\xe6\x50\x63\xc2\xf0\xe8\x70\x3e\xc3\xa7\xc5\xdc\x10\xa6\x7a\xc3\x9f\x9d\x3e\x3f\x6f\x84\xff\xfb\xcc\xfa\x91\x9b\xfd\x83\x2e\xd3\x23\x46\xa4\x60\x7e\xf7\x94\xe5\x89\xc1\x8d\x55\xfb\x96\x44\xf7\x81\xb8\x9e\xae\x7e\x2e\xeb\x9c\x12\x9a\x00\x01\x00\x00\xff\xff\x33\xf8\x17\xdd\x36\x02\x00\x00")
 
 func assetsPlayPngBytes() ([]byte, error) {
@@ -293,6 +314,8 @@ var _bindata = map[string]func() (*asset, error){
 
 	"assets/arrow_up.png": assetsArrow_upPng,
 
+	"assets/bandplan.json": assetsBandplanJson,
+
 	"assets/play.png": assetsPlayPng,
 
 	"assets/stop.png": assetsStopPng,
@@ -344,6 +367,7 @@ var _bintree = &bintree{nil, map[string]*bintree{
 		"FreeSans.ttf":   &bintree{assetsFreesansTtf, map[string]*bintree{}},
 		"arrow_down.png": &bintree{assetsArrow_downPng, map[string]*bintree{}},
 		"arrow_up.png":   &bintree{assetsArrow_upPng, map[string]*bintree{}},
+		"bandplan.json":  &bintree{assetsBandplanJson, map[string]*bintree{}},
 		"play.png":       &bintree{assetsPlayPng, map[string]*bintree{}},
 		"stop.png":       &bintree{assetsStopPng, map[string]*bintree{}},
 	}},
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/llgcode/draw2d/draw2dimg"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gqrxUntagged is the tag GQRX gives to bookmarks without one
+const gqrxUntagged = "Untagged"
+
+// gqrxDefaultColor is the colour GQRX uses for new tags
+const gqrxDefaultColor = "#c0c0c0"
+
+// bookmarkLabelRows is how many rows of labels are stacked over the frequency axis before overlapping
+const bookmarkLabelRows = 3
+
+// Bookmark is a memory channel, everything needed to tune back to a station
+type Bookmark struct {
+	Name      string  `json:"name"`
+	Frequency float64 `json:"frequency"`
+	Mode      string  `json:"mode"`
+	Bandwidth float64 `json:"bandwidth"`
+	// Gain is left unchanged when tuning to the bookmark if negative
+	Gain  float64  `json:"gain"`
+	Tags  []string `json:"tags"`
+	Color string   `json:"color"`
+}
+
+// bookmarks are sorted by frequency
+var bookmarks = make([]Bookmark, 0)
+
+var bookmarkColorNames = []string{"Gray", "Red", "Orange", "Yellow", "Green", "Cyan", "Blue", "Magenta"}
+var bookmarkColors = []string{gqrxDefaultColor, "#ff4040", "#ff9933", "#ffe033", "#40e040", "#33e0e0", "#5080ff", "#ff60ff"}
+
+// Modes as written by GQRX, the first one of each is used on export
+var gqrxModes = map[DemodMode][]string{
+	ModeWFM: {"WFM (stereo)", "WFM (mono)", "WFM (oirt)"},
+	ModeNFM: {"Narrow FM"},
+	ModeAM:  {"AM", "AM-Sync"},
+	ModeUSB: {"USB"},
+	ModeLSB: {"LSB"},
+	ModeCW:  {"CW-U", "CW-L"},
+}
+
+// CurrentBookmark returns a bookmark of what is being listened to
+func CurrentBookmark(name string, tags []string, c string) Bookmark {
+	return Bookmark{
+		Name:      name,
+		Frequency: vfoFrequency,
+		Mode:      demodMode.String(),
+		Bandwidth: demodBandwidth,
+		Gain:      gain,
+		Tags:      tags,
+		Color:     c,
+	}
+}
+
+func AddBookmark(b Bookmark) {
+	bookmarks = append(bookmarks, b)
+	sortBookmarks()
+}
+
+func RemoveBookmark(index int) {
+	if index < 0 || index >= len(bookmarks) {
+		return
+	}
+	bookmarks = append(bookmarks[:index:index], bookmarks[index+1:]...)
+}
+
+func sortBookmarks() {
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		return bookmarks[i].Frequency < bookmarks[j].Frequency
+	})
+}
+
+// TuneBookmark sets the demodulator and the VFO like the bookmark
+func TuneBookmark(b Bookmark) {
+	var mode = demodModeByName(b.Mode)
+	if mode != demodMode {
+		SetDemodMode(mode)
+	}
+	if b.Bandwidth > 0 {
+		SetDemodBandwidth(b.Bandwidth)
+	}
+	if b.Gain >= 0 {
+		SetGain(b.Gain)
+	}
+	SetVFOFrequency(b.Frequency)
+}
+
+// HasTag tells if the bookmark has tag, an empty tag matches everything
+func (b Bookmark) HasTag(tag string) bool {
+	if tag == "" {
+		return true
+	}
+	for _, t := range b.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b Bookmark) RGBA() color.NRGBA {
+	c, err := parseHexColor(b.Color)
+	if err != nil {
+		c, _ = parseHexColor(gqrxDefaultColor)
+	}
+	return c
+}
+
+// parseTags splits a comma separated tag list
+func parseTags(text string) []string {
+	var tags = make([]string, 0)
+	for _, t := range strings.Split(text, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// drawBookmarks labels the visible bookmarks over the frequency axis of the spectrum
+func drawBookmarks(gc *draw2dimg.GraphicContext, img *image.RGBA, width int) {
+	gc.Save()
+	gc.SetFontSize(10)
+	var rowEnd = make([]float64, bookmarkLabelRows)
+	for i := range rowEnd {
+		rowEnd[i] = math.Inf(-1)
+	}
+	for _, b := range bookmarks {
+		var x = math.Round(FrequencyToPixelX(b.Frequency, float64(width)))
+		if x < 0 || x >= float64(width) {
+			continue
+		}
+
+		// Use the lowest row where the label does not overlap the previous one
+		var row = 0
+		for row < bookmarkLabelRows-1 && rowEnd[row] > x {
+			row++
+		}
+		var left, _, right, _ = gc.GetStringBounds(b.Name)
+		rowEnd[row] = x + 3 + right - left + 6
+
+		var c = b.RGBA()
+		var top = float64(fftHeight) - 34 - float64(row)*12
+		DrawLine(float32(x), float32(top), float32(x), float32(fftHeight), c, img)
+		gc.SetFillColor(c)
+		gc.FillStringAt(b.Name, x+3, top+8)
+	}
+	gc.Restore()
+}
+
+// region GQRX CSV
+
+// ParseGQRXBookmarks reads a GQRX bookmarks.csv, a tag table followed by a bookmark table, both separated by semicolons
+func ParseGQRXBookmarks(data []byte) ([]Bookmark, error) {
+	var tagColors = make(map[string]string)
+	var result = make([]Bookmark, 0)
+
+	var scanner = bufio.NewScanner(bytes.NewReader(data))
+	var lineNumber = 0
+	for scanner.Scan() {
+		lineNumber++
+		var line = strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var fields = strings.Split(line, ";")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		if len(fields) == 2 {
+			// Tag and its colour
+			tagColors[fields[0]] = fields[1]
+			continue
+		}
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("line %d: expected frequency; name; modulation; bandwidth; tags", lineNumber)
+		}
+
+		frequency, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid frequency %s", lineNumber, fields[0])
+		}
+		bandwidth, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid bandwidth %s", lineNumber, fields[3])
+		}
+
+		var tags = make([]string, 0)
+		for _, t := range parseTags(fields[4]) {
+			if t != gqrxUntagged {
+				tags = append(tags, t)
+			}
+		}
+
+		var b = Bookmark{
+			Name:      fields[1],
+			Frequency: frequency,
+			Mode:      gqrxModeToMode(fields[2]).String(),
+			Bandwidth: bandwidth,
+			Gain:      -1,
+			Tags:      tags,
+			Color:     gqrxDefaultColor,
+		}
+		var colorTag = gqrxUntagged
+		if len(tags) > 0 {
+			colorTag = tags[0]
+		}
+		if c, ok := tagColors[colorTag]; ok {
+			b.Color = c
+		}
+		result = append(result, b)
+	}
+
+	return result, scanner.Err()
+}
+
+// FormatGQRXBookmarks writes bookmarks in the GQRX bookmarks.csv format. Tags get the colour of their first bookmark.
+func FormatGQRXBookmarks(list []Bookmark) []byte {
+	var tagColors = map[string]string{gqrxUntagged: gqrxDefaultColor}
+	var tagOrder = []string{gqrxUntagged}
+	for _, b := range list {
+		for _, t := range b.Tags {
+			if _, ok := tagColors[t]; !ok {
+				tagColors[t] = b.Color
+				tagOrder = append(tagOrder, t)
+			}
+		}
+	}
+
+	var buff = &bytes.Buffer{}
+	fmt.Fprintf(buff, "# Tag name          ;  color\n")
+	for _, t := range tagOrder {
+		fmt.Fprintf(buff, "%-20s; %s\n", t, tagColors[t])
+	}
+	fmt.Fprintf(buff, "\n# Frequency ; Name                     ; Modulation          ;  Bandwidth; Tags\n")
+	for _, b := range list {
+		var tags = b.Tags
+		if len(tags) == 0 {
+			tags = []string{gqrxUntagged}
+		}
+		var mode = gqrxModes[demodModeByName(b.Mode)][0]
+		fmt.Fprintf(buff, "%12.0f; %-25s; %-20s; %10.0f; %s\n", b.Frequency, b.Name, mode, b.Bandwidth, strings.Join(tags, ","))
+	}
+	return buff.Bytes()
+}
+
+func gqrxModeToMode(name string) DemodMode {
+	for mode, names := range gqrxModes {
+		for _, n := range names {
+			if strings.EqualFold(n, name) {
+				return mode
+			}
+		}
+	}
+	// Raw I/Q and Demod Off have no equivalent
+	return ModeNFM
+}
+
+// ImportGQRXBookmarks adds the bookmarks of a GQRX CSV file, returning how many were added
+func ImportGQRXBookmarks(filename string) (int, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	list, err := ParseGQRXBookmarks(data)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", filename, err)
+	}
+	bookmarks = append(bookmarks, list...)
+	sortBookmarks()
+	log.Printf("Imported %d bookmarks from %s\n", len(list), filename)
+	return len(list), nil
+}
+
+func ExportGQRXBookmarks(filename string) error {
+	return ioutil.WriteFile(filename, FormatGQRXBookmarks(bookmarks), 0644)
+}
+
+// endregion
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"github.com/racerxdl/segdsp/demodcore"
+	"math"
+)
+
+const audioSampleRate = 48000
+
+// Demodulator is satisfied by both the segdsp demodcore demodulators and the ones in this application
+type Demodulator interface {
+	Work(data []complex64) interface{}
+	GetDemodParams() interface{}
+}
+
+type DemodMode int32
+
+const (
+	ModeWFM DemodMode = iota
+	ModeNFM
+	ModeAM
+	ModeUSB
+	ModeLSB
+	ModeCW
+)
+
+var demodModeNames = []string{"WFM", "NFM", "AM", "USB", "LSB", "CW"}
+
+func (m DemodMode) String() string {
+	if int(m) < len(demodModeNames) {
+		return demodModeNames[m]
+	}
+	return "Unknown"
+}
+
+type demodModeInfo struct {
+	defaultBandwidth float64
+	minBandwidth     float64
+	maxBandwidth     float64
+	audioCut         float64
+}
+
+var demodModes = map[DemodMode]demodModeInfo{
+	ModeWFM: {defaultBandwidth: 192e3, minBandwidth: 50e3, maxBandwidth: 250e3, audioCut: 15e3},
+	ModeNFM: {defaultBandwidth: 12.5e3, minBandwidth: 5e3, maxBandwidth: 25e3, audioCut: 4e3},
+	ModeAM:  {defaultBandwidth: 10e3, minBandwidth: 3e3, maxBandwidth: 20e3, audioCut: 5e3},
+	ModeUSB: {defaultBandwidth: 2.7e3, minBandwidth: 1e3, maxBandwidth: 5e3, audioCut: 5e3},
+	ModeLSB: {defaultBandwidth: 2.7e3, minBandwidth: 1e3, maxBandwidth: 5e3, audioCut: 5e3},
+	ModeCW:  {defaultBandwidth: 500, minBandwidth: 100, maxBandwidth: 2e3, audioCut: 2e3},
+}
+
+// ssbLowCut is the lowest audio frequency kept in sideband modes
+const ssbLowCut = 300
+
+// cwPitch is the audio frequency a CW carrier sounds at
+const cwPitch = 700
+
+// ChannelParams describes the channel a demodulator is listening to
+type ChannelParams struct {
+	Mode      DemodMode
+	Bandwidth float64
+	// Passband edges relative to the tuned frequency
+	LowCut  float64
+	HighCut float64
+}
+
+func GetChannelParams(mode DemodMode, bandwidth float64) ChannelParams {
+	var p = ChannelParams{
+		Mode:      mode,
+		Bandwidth: bandwidth,
+		LowCut:    -bandwidth / 2,
+		HighCut:   bandwidth / 2,
+	}
+	switch mode {
+	case ModeUSB:
+		p.LowCut = ssbLowCut
+		p.HighCut = ssbLowCut + bandwidth
+	case ModeLSB:
+		p.LowCut = -ssbLowCut - bandwidth
+		p.HighCut = -ssbLowCut
+	}
+	return p
+}
+
+// BandwidthFromEdge returns the bandwidth that puts a passband edge at offset Hz from the tuned frequency
+func BandwidthFromEdge(mode DemodMode, offset float64) float64 {
+	switch mode {
+	case ModeUSB:
+		return ClampBandwidth(mode, offset-ssbLowCut)
+	case ModeLSB:
+		return ClampBandwidth(mode, -offset-ssbLowCut)
+	}
+	return ClampBandwidth(mode, 2*math.Abs(offset))
+}
+
+func ClampBandwidth(mode DemodMode, bandwidth float64) float64 {
+	var info = demodModes[mode]
+	if bandwidth < info.minBandwidth {
+		return info.minBandwidth
+	} else if bandwidth > info.maxBandwidth {
+		return info.maxBandwidth
+	}
+	return bandwidth
+}
+
+func MakeDemodulator(mode DemodMode, sampleRate, bandwidth, deemphasisTau float64, forceMono bool) Demodulator {
+	bandwidth = ClampBandwidth(mode, bandwidth)
+	if mode == ModeWFM {
+		return makeWBFMDemodulator(sampleRate, bandwidth, deemphasisTau, forceMono)
+	}
+	return makeAnalogDemodulator(mode, sampleRate, bandwidth)
+}
+
+// analogDemodulator implements the narrow band modes: NFM, AM, USB, LSB and CW
+type analogDemodulator struct {
+	params     ChannelParams
+	sampleRate float64
+	ifRate     float64
+
+	decimator     *complexFirFilter
+	channelShift  *frequencyShifter
+	channelFilter *complexFirFilter
+	bfo           *frequencyShifter
+	quad          *quadDemod
+	dcBlock       *dcBlocker
+	agc           *automaticGainControl
+	audioFilter   *floatFirFilter
+	resampler     *audioResampler
+}
+
+func makeAnalogDemodulator(mode DemodMode, sampleRate, bandwidth float64) *analogDemodulator {
+	var params = GetChannelParams(mode, bandwidth)
+	var decimation = int(math.Max(1, math.Floor(sampleRate/audioSampleRate)))
+	var ifRate = sampleRate / float64(decimation)
+
+	// Center of the passband. Sideband modes are shifted so the passband can be selected by a low pass filter.
+	var passbandCenter = (params.LowCut + params.HighCut) / 2
+	var halfWidth = (params.HighCut - params.LowCut) / 2
+
+	var d = &analogDemodulator{
+		params:        params,
+		sampleRate:    sampleRate,
+		ifRate:        ifRate,
+		decimator:     makeComplexFirFilter(makeLowPassTaps(1, sampleRate, ifRate*0.4, ifRate*0.2), decimation),
+		channelShift:  makeFrequencyShifter(-passbandCenter, ifRate),
+		channelFilter: makeComplexFirFilter(makeLowPassTaps(1, ifRate, halfWidth, math.Max(halfWidth*0.3, 300)), 1),
+		audioFilter:   makeFloatFirFilter(makeLowPassTaps(1, ifRate, math.Min(demodModes[mode].audioCut, ifRate*0.45), 1000), 1),
+		resampler:     makeAudioResampler(ifRate, audioSampleRate),
+	}
+
+	switch mode {
+	case ModeNFM:
+		// 5 kHz deviation maps to full scale
+		d.quad = makeQuadDemod(float32(ifRate / (2 * math.Pi * 5e3)))
+	case ModeAM:
+		d.dcBlock = makeDCBlocker(0.999)
+		d.agc = makeAGC(0.5, 0.01, 0.00005)
+	case ModeUSB, ModeLSB:
+		d.bfo = makeFrequencyShifter(passbandCenter, ifRate)
+		d.agc = makeAGC(0.5, 0.01, 0.00005)
+	case ModeCW:
+		d.bfo = makeFrequencyShifter(passbandCenter+cwPitch, ifRate)
+		d.agc = makeAGC(0.5, 0.01, 0.00005)
+	}
+
+	return d
+}
+
+func (d *analogDemodulator) GetDemodParams() interface{} {
+	return d.params
+}
+
+func (d *analogDemodulator) Work(data []complex64) interface{} {
+	var iq = d.decimator.Work(data)
+	iq = d.channelShift.Work(iq)
+	iq = d.channelFilter.Work(iq)
+
+	var audio []float32
+
+	switch d.params.Mode {
+	case ModeNFM:
+		audio = d.quad.Work(iq)
+	case ModeAM:
+		audio = make([]float32, len(iq))
+		for i, v := range iq {
+			audio[i] = float32(math.Hypot(float64(real(v)), float64(imag(v))))
+		}
+		audio = d.dcBlock.Work(audio)
+	default:
+		iq = d.bfo.Work(iq)
+		audio = make([]float32, len(iq))
+		for i, v := range iq {
+			audio[i] = real(v)
+		}
+	}
+
+	if d.agc != nil {
+		audio = d.agc.Work(audio)
+	}
+
+	audio = d.audioFilter.Work(audio)
+	audio = d.resampler.Work(audio)
+
+	return demodcore.DemodData{
+		Data: audio,
+	}
+}
@@ -3,21 +3,20 @@ package main
 import (
 	"fmt"
 	"github.com/gordonklaus/portaudio"
-	"github.com/myriadrf/limedrv"
 	"github.com/racerxdl/go.fifo"
 	"github.com/racerxdl/segdsp/demodcore"
 	"github.com/racerxdl/segdsp/dsp"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const audioBufferSize = 8192
+const audioChannels = 2
 
 var lastFFT = time.Now()
 var gain float64
-var lpf float64
-var channel int
 var sampleRate float64
 var antenna int32
 var antennaStringData = ""
@@ -28,29 +27,71 @@ var fftSizes = "128\x00256\x00512\x001024\x002048\x004096\x008192\x0016384"
 var fftSizesLen = int32(len(strings.Split(fftSizes, "\x00")))
 
 var selectedFFTSize = int32(5)
-var dev *limedrv.LMSDevice
+var source SampleSource
+
+// sourceFactory builds the SampleSource used by InitializeDSP
+var sourceFactory = func() SampleSource {
+	return MakeLimeSDRSource(0, 0)
+}
 
 var dspLoaded TAtomBool
 var dspLoadError = ""
 var isRunning = false
 
 var dcFilter = dsp.MakeDCFilter()
-var demodulator demodcore.DemodCore
+var demodulator Demodulator
+var demodMode = ModeWFM
+var demodBandwidth = demodModes[ModeWFM].defaultBandwidth
+var deemphasisTau = deemphasis75us
+var forceMono = false
+var stereoDetected TAtomBool
+var rdsDecoder = MakeRDSDecoder()
+
+// retuneCount changes on every LO or sample rate change. The sample blocks are tagged with it, so the ones captured
+// before a retune, still in the driver or network buffers, are not measured as the new channel.
+var retuneCount TAtomCounter
+
+// retuneSettleBlocks is how many blocks arriving after a retune can still hold samples captured before it
+const retuneSettleBlocks = 2
+
+// samplesRetune and blocksSinceRetune are only used by the source goroutine calling OnSamples
+var samplesRetune uint32
+var blocksSinceRetune = 0
 
 var audioStream *portaudio.Stream
 var audioFifo = fifo.NewQueue()
+var audioPending []float32
 
 func OnSamples(data []complex64, _ int, _ uint64) {
-	go DoDemod(data)
-	go DoFFT(data)
+	var retune = retuneCount.Get()
+	if retune != samplesRetune {
+		samplesRetune = retune
+		blocksSinceRetune = 0
+	}
+	blocksSinceRetune++
+
+	recordSamples(data)
+	shareSamples(data)
+	if !headless {
+		go DoDemod(data)
+	}
+	// A block is settled when it was received late enough after the last retune to be captured after it
+	var settled = -1
+	if blocksSinceRetune > retuneSettleBlocks {
+		settled = int(retune)
+	}
+	go DoFFT(data, settled)
 }
 
-func DoFFT(data []complex64) {
+// DoFFT hands data to Gen. settled is the retune count the samples were captured with, -1 when it is not known yet.
+func DoFFT(data []complex64, settled int) {
 	samplesMtx.Lock()
 	defer samplesMtx.Unlock()
-	if time.Since(lastFFT) > time.Second/60 {
+	// The last block of a file can be too short for the FFT
+	if len(data) >= int(fftSize) && time.Since(lastFFT) > time.Second/60 {
 		fftLock.Lock()
 		fftSamples = data[:fftSize]
+		fftSamplesRetune = settled
 		fftLock.Unlock()
 		data = dcFilter.Work(fftSamples)
 		go Gen()
@@ -62,16 +103,48 @@ func DoFFT(data []complex64) {
 func DoDemod(samples []complex64) {
 	samplesMtx.Lock()
 	defer samplesMtx.Unlock()
-	out := demodulator.Work(samples)
-	if out != nil {
-		var o = out.(demodcore.DemodData)
-		var nBf = make([]float32, len(o.Data))
-		copy(nBf, o.Data)
-		var buffs = len(nBf) / audioBufferSize
-		for i := 0; i < buffs; i++ {
-			audioFifo.Add(nBf[8192*i : 8192*(i+1)])
-		}
+	out := demodulator.Work(vfoShifter.Work(samples))
+	if out == nil {
+		return
+	}
+
+	// Audio is interleaved stereo, mono demodulators output the same data on both channels
+	var left, right []float32
+	switch o := out.(type) {
+	case demodcore.DemodData:
+		left, right = o.Data, o.Data
+		stereoDetected.Set(false)
+	case StereoDemodData:
+		left, right = o.Left, o.Right
+		stereoDetected.Set(o.Stereo)
+		rdsDecoder.Feed(o.RDSBits)
+	default:
+		return
+	}
+
+	var nBf = audioPending
+	for i := range left {
+		nBf = append(nBf, left[i], right[i])
+	}
+
+	// Keep whatever does not fill a full buffer for the next call
+	var buffSize = audioBufferSize * audioChannels
+	var buffs = len(nBf) / buffSize
+	for i := 0; i < buffs; i++ {
+		var buff = make([]float32, buffSize)
+		copy(buff, nBf[buffSize*i:buffSize*(i+1)])
+		audioFifo.Add(buff)
 	}
+	audioPending = append(audioPending[:0], nBf[buffSize*buffs:]...)
+}
+
+func IsStereo() bool {
+	return stereoDetected.Get()
+}
+
+// GetRDSInfo returns the station metadata decoded so far from the tuned broadcast FM station
+func GetRDSInfo() RDSInfo {
+	return rdsDecoder.GetInfo()
 }
 
 func UpdateVisuals() {
@@ -81,8 +154,12 @@ func UpdateVisuals() {
 func Start() {
 	if dspLoaded.Get() && !isRunning {
 		log.Println("Starting DSP")
-		dev.Start()
-		err := audioStream.Start()
+		err := source.Start()
+		if err != nil {
+			log.Printf("Error starting %s: %s\n", source.GetName(), err)
+			return
+		}
+		err = audioStream.Start()
 		if err != nil {
 			panic(err)
 		}
@@ -93,9 +170,12 @@ func Start() {
 func Stop() {
 	if dspLoaded.Get() && isRunning {
 		log.Println("Stopping DSP")
-		dev.Stop()
+		err := source.Stop()
+		if err != nil {
+			log.Printf("Error stopping %s: %s\n", source.GetName(), err)
+		}
 		log.Println("Stopping Audio")
-		err := audioStream.Stop()
+		err = audioStream.Stop()
 		if err != nil {
 			log.Println("Error stopping audio: ", err)
 		}
@@ -119,57 +199,157 @@ func ProcessAudio(out []float32) {
 	}
 }
 
-func InitializeLimeSDR() {
+func InitializeDSP() {
 	dspLoadError = ""
-	devices := limedrv.GetDevices()
 
-	if len(devices) == 0 {
-		dspLoadError = "No devices found"
+	// A previous attempt may have opened the source before failing on the audio
+	if source != nil {
+		err := source.Close()
+		if err != nil {
+			log.Printf("Error closing %s: %s\n", source.GetName(), err)
+		}
+		source = nil
+	}
+
+	var src = sourceFactory()
+	err := src.Open()
+	if err != nil {
+		dspLoadError = err.Error()
 		return
 	}
 
-	dev = limedrv.Open(devices[0])
-	gain = 0.4
-	lpf = 10e6
-	channel = 0
-	sampleRate = 2e6
-	antenna = 0
-	centerFreq = 96.9e6 // 106.3e6
+	attachSource(src)
+	restoreTuning()
+
+	if audioStream == nil {
+		err = InitializeAudio()
+		if err != nil {
+			dspLoadError = err.Error()
+			return
+		}
+	}
+
+	dspLoaded.Set(true)
+}
+
+// attachSource makes an already opened source the active one, loading its parameters into the application
+func attachSource(src SampleSource) {
+	retuneCount.Increment()
+	source = src
+	gain = source.GetGain()
+	sampleRate = source.GetSampleRate()
+	antenna = int32(source.GetAntenna())
+	centerFreq = source.GetCenterFrequency()
+	centerFreqText = ""
+
+	source.SetCallback(OnSamples)
+	if fn, ok := source.(FrequencyNotifier); ok {
+		fn.SetFrequencyCallback(onSourceFrequencyChange)
+	}
+
+	updateAntennaList()
+
+	rdsDecoder.Reset()
+	updateDemodulator()
+	// Moves the LO off the channel when offset tuning is on
+	SetVFOFrequency(centerFreq)
+}
+
+// SwitchSource replaces the current source by src, keeping the running state
+func SwitchSource(src SampleSource) error {
+	var isR = IsRunning()
+	if isR {
+		Stop()
+	}
+
+	err := src.Open()
+	if err != nil {
+		if isR {
+			Start()
+		}
+		return err
+	}
 
-	dev.SetCallback(OnSamples)
-	dev.SetSampleRate(sampleRate, 4)
-	dev.RXChannels[channel].
-		SetAntenna(int(antenna)).
-		SetGainNormalized(gain).
-		SetLPF(lpf).
-		SetCenterFrequency(centerFreq).
-		EnableLPF().
-		Enable()
+	StopRecording()
 
-	antennaCount = int32(len(dev.RXChannels[channel].Antennas))
-	antennaList = make([]string, antennaCount)
+	if source != nil {
+		err = source.Close()
+		if err != nil {
+			log.Printf("Error closing %s: %s\n", source.GetName(), err)
+		}
+	}
 
-	frequencySelector.SetFrequency(uint32(centerFreq))
+	log.Printf("Switched source to %s\n", src.GetName())
+	attachSource(src)
 
-	for i := 0; i < len(dev.RXChannels[channel].Antennas); i++ {
-		var ant = dev.RXChannels[channel].Antennas[i]
-		antennaStringData += fmt.Sprintf("%s\x00", ant.Name)
-		antennaList[i] = ant.Name
+	if isR {
+		Start()
 	}
 
-	demodulator = demodcore.MakeWBFMDemodulator(uint32(sampleRate), 192e3, 48000)
+	return nil
+}
+
+func onSourceFrequencyChange(frequency float64) {
+	retuneCount.Increment()
+	centerFreq = frequency
+	centerFreqText = ""
+	keepVFOInSpan()
+}
+
+func updateDemodulator() {
+	samplesMtx.Lock()
+	defer samplesMtx.Unlock()
+	demodulator = MakeDemodulator(demodMode, sampleRate, demodBandwidth, deemphasisTau, forceMono)
+	audioPending = audioPending[:0]
+}
+
+func SetDemodMode(mode DemodMode) {
+	demodMode = mode
+	demodBandwidth = demodModes[mode].defaultBandwidth
+	rdsDecoder.Reset()
+	updateDemodulator()
+}
+
+func SetDeemphasis(tau float64) {
+	deemphasisTau = tau
+	updateDemodulator()
+}
+
+func SetForceMono(mono bool) {
+	forceMono = mono
+	updateDemodulator()
+}
+
+func SetDemodBandwidth(bandwidth float64) {
+	demodBandwidth = ClampBandwidth(demodMode, bandwidth)
+	updateDemodulator()
+}
 
+func updateAntennaList() {
+	antennaList = source.GetAntennas()
+	if len(antennaList) == 0 {
+		antennaList = []string{"Default"}
+	}
+	antennaCount = int32(len(antennaList))
+	antennaStringData = ""
+	for i := 0; i < len(antennaList); i++ {
+		antennaStringData += fmt.Sprintf("%s\x00", antennaList[i])
+	}
+	if antenna >= antennaCount {
+		antenna = 0
+	}
+}
+
+func InitializeAudio() error {
 	err := portaudio.Initialize()
 	if err != nil {
-		dspLoadError = err.Error()
-		return
+		return err
 	}
 
 	h, err := portaudio.DefaultHostApi()
 
 	if err != nil {
-		dspLoadError = err.Error()
-		return
+		return err
 	}
 
 	//log.Printf("Audio Device: %s\n", h.DefaultOutputDevice.Name)
@@ -178,36 +358,145 @@ func InitializeLimeSDR() {
 	//	log.Printf("%d: %s\n", i, h.Devices[i].Name)
 	//}
 
-	p := portaudio.HighLatencyParameters(nil, h.DefaultOutputDevice)
+	p := portaudio.HighLatencyParameters(nil, audioOutputDevice(h))
 	p.Input.Channels = 0
-	p.Output.Channels = 1
+	p.Output.Channels = audioChannels
 	p.SampleRate = 48000
 	p.FramesPerBuffer = audioBufferSize
 
 	// Add few empty buffers to keep up on start
-	audioFifo.Add(make([]float32, audioBufferSize))
-	audioFifo.Add(make([]float32, audioBufferSize))
-	audioFifo.Add(make([]float32, audioBufferSize))
-	audioFifo.Add(make([]float32, audioBufferSize))
+	audioFifo.Add(make([]float32, audioBufferSize*audioChannels))
+	audioFifo.Add(make([]float32, audioBufferSize*audioChannels))
+	audioFifo.Add(make([]float32, audioBufferSize*audioChannels))
+	audioFifo.Add(make([]float32, audioBufferSize*audioChannels))
 
 	audioStream, err = portaudio.OpenStream(p, ProcessAudio)
 
+	return err
+}
+
+// audioOutputDevice finds the device of the settings by index or name, falling back to the default one
+func audioOutputDevice(h *portaudio.HostApiInfo) *portaudio.DeviceInfo {
+	var name = settings.AudioDevice
+	if name == "" {
+		return h.DefaultOutputDevice
+	}
+
+	devices, err := portaudio.Devices()
 	if err != nil {
-		dspLoadError = err.Error()
-		return
+		log.Printf("Error listing audio devices: %s\n", err)
+		return h.DefaultOutputDevice
+	}
+	if index, err := strconv.Atoi(name); err == nil && index >= 0 && index < len(devices) && devices[index].MaxOutputChannels > 0 {
+		return devices[index]
+	}
+	for _, d := range devices {
+		if d.MaxOutputChannels > 0 && strings.Contains(strings.ToLower(d.Name), strings.ToLower(name)) {
+			return d
+		}
 	}
 
-	dspLoaded.Set(true)
+	log.Printf("Audio device %s not found, using %s\n", name, h.DefaultOutputDevice.Name)
+	return h.DefaultOutputDevice
+}
+
+// region Source Controls
+
+// SetCenterFrequency retunes the LO, the VFO keeps its frequency if it is still inside the captured span
+func SetCenterFrequency(frequency float64) {
+	if frequency != centerFreq {
+		retuneCount.Increment()
+	}
+	centerFreq = frequency
+	centerFreqText = ""
+	if source != nil {
+		err := source.SetCenterFrequency(frequency)
+		if err != nil {
+			log.Printf("Error setting center frequency: %s\n", err)
+		}
+	}
+	keepVFOInSpan()
+	updateRecordingParams()
+}
+
+func SetSampleRate(newSampleRate float64) error {
+	if source == nil {
+		sampleRate = newSampleRate
+		return nil
+	}
+	var isR = IsRunning()
+	if isR {
+		Stop()
+	}
+	err := source.SetSampleRate(newSampleRate)
+	if err == nil && newSampleRate != sampleRate {
+		retuneCount.Increment()
+		// The recording metadata has a single sample rate
+		StopRecording()
+		sampleRate = newSampleRate
+		keepVFOInSpan()
+		updateDemodulator()
+	}
+	if isR {
+		Start()
+	}
+	return err
+}
+
+func SetGain(newGain float64) {
+	gain = newGain
+	if source != nil {
+		err := source.SetGain(newGain)
+		if err != nil {
+			log.Printf("Error setting gain: %s\n", err)
+		}
+	}
+	updateRecordingParams()
 }
 
+func SetAntenna(newAntenna int32) {
+	if source == nil {
+		antenna = newAntenna
+		return
+	}
+	var isR = IsRunning()
+	if isR {
+		Stop()
+	}
+	err := source.SetAntenna(int(newAntenna))
+	if err != nil {
+		log.Printf("Error setting antenna: %s\n", err)
+	} else {
+		antenna = newAntenna
+	}
+	if isR {
+		Start()
+	}
+	updateRecordingParams()
+}
+
+// endregion
+
 func onDspClose() {
+	err := SaveSettings()
+	if err != nil {
+		log.Printf("Error saving settings: %s\n", err)
+	}
+	StopRecording()
+	StopSharing()
+	if source != nil {
+		err := source.Close()
+		if err != nil {
+			log.Printf("Error closing %s: %s", source.GetName(), err)
+		}
+	}
 	if audioStream != nil {
 		err := audioStream.Close()
 		if err != nil {
 			log.Printf("Error closing stream: %s", err)
 		}
 	}
-	err := portaudio.Terminate()
+	err = portaudio.Terminate()
 	if err != nil {
 		log.Printf("Error terminating portaudio: %s", err)
 	}
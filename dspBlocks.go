@@ -0,0 +1,271 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// region Filter Design
+
+// makeLowPassTaps designs a Hamming windowed sinc low pass filter
+func makeLowPassTaps(gain, sampleRate, cutFrequency, transitionWidth float64) []float32 {
+	var numTaps = int(math.Ceil(3.3 * sampleRate / transitionWidth))
+	if numTaps%2 == 0 {
+		numTaps++
+	}
+	if numTaps < 3 {
+		numTaps = 3
+	}
+
+	var fc = cutFrequency / sampleRate
+	var mid = (numTaps - 1) / 2
+	var taps = make([]float64, numTaps)
+	var sum = 0.0
+
+	for i := 0; i < numTaps; i++ {
+		var x = float64(i - mid)
+		var sinc float64
+		if x == 0 {
+			sinc = 2 * fc
+		} else {
+			sinc = math.Sin(2*math.Pi*fc*x) / (math.Pi * x)
+		}
+		var w = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(numTaps-1))
+		taps[i] = sinc * w
+		sum += taps[i]
+	}
+
+	var out = make([]float32, numTaps)
+	for i := range taps {
+		out[i] = float32(taps[i] * gain / sum)
+	}
+
+	return out
+}
+
+// endregion
+// region FIR Filters
+
+type complexFirFilter struct {
+	taps       []float32
+	decimation int
+	history    []complex64
+}
+
+func makeComplexFirFilter(taps []float32, decimation int) *complexFirFilter {
+	if decimation < 1 {
+		decimation = 1
+	}
+	return &complexFirFilter{
+		taps:       taps,
+		decimation: decimation,
+		history:    make([]complex64, 0),
+	}
+}
+
+func (f *complexFirFilter) Work(data []complex64) []complex64 {
+	var buff = append(f.history, data...)
+	var numTaps = len(f.taps)
+	var out = make([]complex64, 0, len(buff)/f.decimation+1)
+	var p = 0
+	for ; p+numTaps <= len(buff); p += f.decimation {
+		var r, i float32
+		var window = buff[p : p+numTaps]
+		for k, t := range f.taps {
+			r += real(window[k]) * t
+			i += imag(window[k]) * t
+		}
+		out = append(out, complex(r, i))
+	}
+	f.history = append(f.history[:0:0], buff[p:]...)
+	return out
+}
+
+type floatFirFilter struct {
+	taps       []float32
+	decimation int
+	history    []float32
+}
+
+func makeFloatFirFilter(taps []float32, decimation int) *floatFirFilter {
+	if decimation < 1 {
+		decimation = 1
+	}
+	return &floatFirFilter{
+		taps:       taps,
+		decimation: decimation,
+		history:    make([]float32, 0),
+	}
+}
+
+func (f *floatFirFilter) Work(data []float32) []float32 {
+	var buff = append(f.history, data...)
+	var numTaps = len(f.taps)
+	var out = make([]float32, 0, len(buff)/f.decimation+1)
+	var p = 0
+	for ; p+numTaps <= len(buff); p += f.decimation {
+		var v float32
+		var window = buff[p : p+numTaps]
+		for k, t := range f.taps {
+			v += window[k] * t
+		}
+		out = append(out, v)
+	}
+	f.history = append(f.history[:0:0], buff[p:]...)
+	return out
+}
+
+// endregion
+// region Mixers and Demodulators
+
+// frequencyShifter multiplies the signal by a complex exponential, moving it by frequency Hz
+type frequencyShifter struct {
+	phasor   complex128
+	rotation complex128
+}
+
+func makeFrequencyShifter(frequency, sampleRate float64) *frequencyShifter {
+	var fs = &frequencyShifter{phasor: 1}
+	fs.SetFrequency(frequency, sampleRate)
+	return fs
+}
+
+func (fs *frequencyShifter) SetFrequency(frequency, sampleRate float64) {
+	fs.rotation = cmplx.Rect(1, 2*math.Pi*frequency/sampleRate)
+}
+
+func (fs *frequencyShifter) Work(data []complex64) []complex64 {
+	var out = make([]complex64, len(data))
+	for i, v := range data {
+		out[i] = v * complex64(fs.phasor)
+		fs.phasor *= fs.rotation
+	}
+	// Avoid amplitude drift due to accumulated rounding
+	fs.phasor /= complex(cmplx.Abs(fs.phasor), 0)
+	return out
+}
+
+type quadDemod struct {
+	last complex64
+	gain float32
+}
+
+func makeQuadDemod(gain float32) *quadDemod {
+	return &quadDemod{gain: gain}
+}
+
+func (q *quadDemod) Work(data []complex64) []float32 {
+	var out = make([]float32, len(data))
+	for i, v := range data {
+		var d = v * complex(real(q.last), -imag(q.last))
+		out[i] = q.gain * float32(math.Atan2(float64(imag(d)), float64(real(d))))
+		q.last = v
+	}
+	return out
+}
+
+// endregion
+// region Audio Processing
+
+type automaticGainControl struct {
+	level  float32
+	target float32
+	attack float32
+	decay  float32
+}
+
+func makeAGC(target, attack, decay float32) *automaticGainControl {
+	return &automaticGainControl{
+		level:  1e-3,
+		target: target,
+		attack: attack,
+		decay:  decay,
+	}
+}
+
+func (a *automaticGainControl) Work(data []float32) []float32 {
+	var out = make([]float32, len(data))
+	for i, v := range data {
+		var env = float32(math.Abs(float64(v)))
+		if env > a.level {
+			a.level += (env - a.level) * a.attack
+		} else {
+			a.level *= 1 - a.decay
+		}
+		if a.level < 1e-6 {
+			a.level = 1e-6
+		}
+		out[i] = v * a.target / a.level
+	}
+	return out
+}
+
+type dcBlocker struct {
+	lastIn  float32
+	lastOut float32
+	r       float32
+}
+
+func makeDCBlocker(r float32) *dcBlocker {
+	return &dcBlocker{r: r}
+}
+
+func (d *dcBlocker) Work(data []float32) []float32 {
+	var out = make([]float32, len(data))
+	for i, v := range data {
+		d.lastOut = v - d.lastIn + d.r*d.lastOut
+		d.lastIn = v
+		out[i] = d.lastOut
+	}
+	return out
+}
+
+type deemphasisFilter struct {
+	alpha float32
+	last  float32
+}
+
+func makeDeemphasisFilter(tau, sampleRate float64) *deemphasisFilter {
+	return &deemphasisFilter{
+		alpha: float32(1 - math.Exp(-1/(sampleRate*tau))),
+	}
+}
+
+func (d *deemphasisFilter) Work(data []float32) []float32 {
+	var out = make([]float32, len(data))
+	for i, v := range data {
+		d.last += d.alpha * (v - d.last)
+		out[i] = d.last
+	}
+	return out
+}
+
+// audioResampler converts between arbitrary rates using linear interpolation. The input must already be band limited.
+type audioResampler struct {
+	step     float64
+	position float64
+	last     float32
+}
+
+func makeAudioResampler(inputRate, outputRate float64) *audioResampler {
+	return &audioResampler{
+		step: inputRate / outputRate,
+	}
+}
+
+func (r *audioResampler) Work(data []float32) []float32 {
+	var buff = append([]float32{r.last}, data...)
+	var out = make([]float32, 0, int(float64(len(data))/r.step)+1)
+	var last = float64(len(buff) - 1)
+	for r.position < last {
+		var i = int(r.position)
+		var frac = float32(r.position - float64(i))
+		out = append(out, buff[i]*(1-frac)+buff[i+1]*frac)
+		r.position += r.step
+	}
+	r.position -= last
+	r.last = buff[len(buff)-1]
+	return out
+}
+
+// endregion
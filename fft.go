@@ -5,14 +5,13 @@ import (
 	"github.com/golang/freetype/truetype"
 	"github.com/llgcode/draw2d"
 	"github.com/llgcode/draw2d/draw2dimg"
-	"github.com/racerxdl/segdsp/demodcore"
-	"github.com/racerxdl/segdsp/dsp"
 	"github.com/racerxdl/segdsp/dsp/fft"
 	"github.com/racerxdl/segdsp/tools"
 	"image"
 	"image/color"
 	"image/draw"
 	"math"
+	"sort"
 	"sync"
 )
 
@@ -26,8 +25,17 @@ const vGridSteps = 8
 
 // endregion
 // region Variables
+// fftOffset is the reference level, the power at the top of the spectrum in dB
 var fftOffset = float32(-40)
-var fftScale = float32(4)
+
+// fftScale is the number of pixels per dB, derived from fftDBPerDiv
+var fftScale = float32(fftHeight) / (hGridSteps * 10)
+var fftDBPerDiv = float32(10)
+var dbPerDivSteps = []float32{1, 2, 3, 5, 10, 15, 20}
+
+// Levels mapped to the first and last colours of the waterfall
+var waterfallMin = float32(-100)
+var waterfallMax = float32(-40)
 
 var fftCache []float32
 var acc = float32(4.5)
@@ -37,16 +45,20 @@ var img = image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight))
 var gc = draw2dimg.NewGraphicContext(img)
 var fftSamples = make([]complex64, fftSize)
 
+// fftSamplesRetune is the retune count fftSamples were captured with, -1 if they may be from before the last retune
+var fftSamplesRetune = -1
+
 var samplesMtx = sync.Mutex{}
 
 var isUpdated = false
 
-var window = dsp.BlackmanHarris(int(fftSize), 61)
+var fftWindowType = WindowBlackmanHarris
+var kaiserBeta = 6.0
+var window = MakeFFTWindow(fftWindowType, int(fftSize), kaiserBeta)
 
 // endregion
 
 var waterFallLut = make([]color.Color, 0)
-var waterFallBuffers = make([]*image.RGBA, wtfHeight)
 
 func init() {
 	fontBytes := MustAsset("assets/FreeSans.ttf")
@@ -69,84 +81,214 @@ func init() {
 	gc.SetStrokeColor(color.RGBA{R: 255, A: 255})
 	gc.SetFillColor(color.RGBA{R: 0, A: 255})
 
-	// From GQRX: https://github.com/csete/gqrx -> qtgui/plotter.cpp
-	for i := 0; i < 256; i++ {
-		if i < 20 {
-			// level 0: black background
-			waterFallLut = append(waterFallLut, color.NRGBA{A: 255})
-		} else if (i >= 20) && (i < 70) {
-			// level 1: black -> blue
-			waterFallLut = append(waterFallLut, color.NRGBA{B: uint8(140 * (i - 20) / 50), A: 255})
-		} else if (i >= 70) && (i < 100) {
-			// level 2: blue -> light-blue / greenish
-			waterFallLut = append(waterFallLut, color.NRGBA{R: uint8(60 * (i - 70) / 30), G: uint8(125 * (i - 70) / 30), B: uint8(115*(i-70)/30 + 140), A: 255})
-		} else if (i >= 100) && (i < 150) {
-			// level 3: light blue -> yellow
-			waterFallLut = append(waterFallLut, color.NRGBA{R: uint8(195*(i-100)/50 + 60), G: uint8(130*(i-100)/50 + 125), B: uint8(255 - (255 * (i - 100) / 50)), A: 255})
-		} else if (i >= 150) && (i < 250) {
-			// level 4: yellow -> red
-			waterFallLut = append(waterFallLut, color.NRGBA{R: 255, G: uint8(255 - 255*(i-150)/100), A: 255})
-		} else {
-			// level 5: red -> white
-			waterFallLut = append(waterFallLut, color.NRGBA{R: 255, G: uint8(255 * (i - 250) / 5), B: uint8(255 * (i - 250) / 5), A: 255})
-		}
+	waterFallLut = palettes[selectedPalette].lut
+}
+
+// region Zoom and Pan
+
+const maxSpectrumZoom = 64
+
+var spectrumZoom = 1.0
+
+// spectrumPan is the center of the visible span relative to centerFreq
+var spectrumPan = 0.0
+
+func GetVisibleSpan() float64 {
+	return sampleRate / spectrumZoom
+}
+
+func GetVisibleCenter() float64 {
+	var maxPan = (sampleRate - GetVisibleSpan()) / 2
+	return centerFreq + math.Max(-maxPan, math.Min(maxPan, spectrumPan))
+}
+
+// SetSpectrumZoom changes the zoom keeping anchor at the same place of the screen
+func SetSpectrumZoom(zoom, anchor float64) {
+	zoom = math.Max(1, math.Min(maxSpectrumZoom, zoom))
+	var position = (anchor - GetVisibleCenter()) / GetVisibleSpan()
+	spectrumZoom = zoom
+	SetSpectrumPan(anchor - position*GetVisibleSpan() - centerFreq)
+}
+
+func SetSpectrumPan(pan float64) {
+	var maxPan = (sampleRate - GetVisibleSpan()) / 2
+	spectrumPan = math.Max(-maxPan, math.Min(maxPan, pan))
+}
+
+// ShowFrequency pans the spectrum when frequency is out of the visible span
+func ShowFrequency(frequency float64) {
+	var center = GetVisibleCenter()
+	if math.Abs(frequency-center) > GetVisibleSpan()/2 {
+		SetSpectrumPan(frequency - centerFreq)
 	}
 }
 
+// endregion
+
 func FrequencyToPixelX(frequency, width float64) float64 {
-	var hzPerPixel = sampleRate / float64(width)
-	var delta = centerFreq - float64(frequency)
+	var hzPerPixel = GetVisibleSpan() / float64(width)
+	var delta = float64(frequency) - GetVisibleCenter()
 	var centerX = float64(width / 2)
 
 	return centerX + (delta / hzPerPixel)
 }
 
-func drawGrid(gc *draw2dimg.GraphicContext, img *image.RGBA, fftOffset, fftScale, width int) {
+// PixelXToFrequency is the inverse of FrequencyToPixelX
+func PixelXToFrequency(x, width float64) float64 {
+	var hzPerPixel = GetVisibleSpan() / float64(width)
+	var centerX = float64(width / 2)
+
+	return GetVisibleCenter() + (x-centerX)*hzPerPixel
+}
+
+// spectrumPixels maps a spectrum, with the lowest frequency first, to width pixels of the visible span.
+// When a pixel covers many bins it gets the strongest one. Pixels outside the captured span are NaN.
+func spectrumPixels(row waterfallRow, width int) []float32 {
+	var out = make([]float32, width)
+	var n = len(row.spectrum)
+	var start = row.centerFrequency - row.sampleRate/2
+	var binsPerHz = float64(n) / row.sampleRate
+
+	for x := range out {
+		var b0 = (PixelXToFrequency(float64(x), float64(width)) - start) * binsPerHz
+		var b1 = (PixelXToFrequency(float64(x+1), float64(width)) - start) * binsPerHz
+		var first = int(math.Floor(b0))
+		var last = int(math.Ceil(b1)) - 1
+		if last < first {
+			last = first
+		}
+		if last < 0 || first >= n {
+			out[x] = float32(math.NaN())
+			continue
+		}
+		if first < 0 {
+			first = 0
+		}
+		if last >= n {
+			last = n - 1
+		}
+		var v = row.spectrum[first]
+		for _, s := range row.spectrum[first+1 : last+1] {
+			if s > v {
+				v = s
+			}
+		}
+		out[x] = v
+	}
+
+	return out
+}
+
+// niceGridStep rounds step up to 1, 2 or 5 times a power of 10
+func niceGridStep(step float64) float64 {
+	var magnitude = math.Pow(10, math.Floor(math.Log10(step)))
+	for _, m := range []float64{1, 2, 5} {
+		if m*magnitude >= step {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// formatAxisFrequency prints frequency with enough decimals to tell apart grid lines step Hz apart
+func formatAxisFrequency(frequency, step float64) string {
+	var units = []string{"", "k", "M", "G"}
+	var u = 0
+	for u < len(units)-1 && math.Abs(frequency) >= math.Pow(1000, float64(u+1)) {
+		u++
+	}
+	var scale = math.Pow(1000, float64(u))
+	var decimals = int(math.Max(0, math.Ceil(-math.Log10(step/scale)-1e-9)))
+	return fmt.Sprintf("%.*f %sHz", decimals, frequency/scale, units[u])
+}
+
+func SetDBPerDiv(dbPerDiv float32) {
+	fftDBPerDiv = dbPerDiv
+	fftScale = float32(fftHeight) / (hGridSteps * dbPerDiv)
+}
+
+// AutoRange fits the reference level and scale to the peaks and noise floor of the visible spectrum, and the waterfall levels to the noise floor
+func AutoRange() {
+	if len(lastSpectrumRow.spectrum) == 0 {
+		return
+	}
+	var values = make([]float64, 0, imgWidth)
+	for _, v := range spectrumPixels(lastSpectrumRow, imgWidth) {
+		if !tools.IsNaN(v) {
+			values = append(values, float64(v))
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	sort.Float64s(values)
+
+	// Most of the span is noise, so a low percentile is a good noise floor estimate
+	var noiseFloor = values[len(values)/5]
+	var peak = values[len(values)-1]
+
+	fftOffset = float32(math.Ceil((peak+5)/5) * 5)
+	var dbPerDiv = dbPerDivSteps[len(dbPerDivSteps)-1]
+	for _, step := range dbPerDivSteps {
+		if float64(step*hGridSteps) >= float64(fftOffset)-(noiseFloor-10) {
+			dbPerDiv = step
+			break
+		}
+	}
+	SetDBPerDiv(dbPerDiv)
+
+	waterfallMin = float32(math.Floor(noiseFloor - 3))
+	waterfallMax = float32(math.Ceil(peak))
+	if waterfallMax-waterfallMin < 10 {
+		waterfallMax = waterfallMin + 10
+	}
+}
+
+func drawGrid(gc *draw2dimg.GraphicContext, img *image.RGBA, fftOffset, fftScale float32, width int) {
 	var lineColor = color.NRGBA{R: 255, G: 127, B: 127, A: 127}
 	gc.Save()
 	gc.SetFontSize(10)
 	gc.SetFillColor(color.NRGBA{R: 127, G: 127, B: 127, A: 255})
 
-	var startFreq = centerFreq - (sampleRate / 2)
-	var hzPerPixel = sampleRate / float64(width)
+	var startFreq = PixelXToFrequency(0, float64(width))
+	var span = GetVisibleSpan()
 
 	// region Draw dB Scale Grid
 	for i := 0; i < hGridSteps; i++ {
 		var y = float64(i) * (float64(fftHeight) / float64(hGridSteps))
-		var dB = int(float64(fftOffset) - float64(y)/float64(fftScale))
+		var dB = int(math.Round(float64(fftOffset) - float64(y)/float64(fftScale)))
 		DrawLine(0, float32(y), float32(width), float32(y), lineColor, img)
 		gc.FillStringAt(fmt.Sprintf("%d dB", dB), 5, y-5)
 	}
 	// endregion
 	// region Draw Frequency Scale Grid
-	for i := 0; i < vGridSteps; i++ {
-		var x = math.Round(float64(i) * (float64(width) / float64(vGridSteps)))
+	var step = niceGridStep(span / vGridSteps)
+	for v := math.Ceil(startFreq/step) * step; v < startFreq+span; v += step {
+		var x = math.Round(FrequencyToPixelX(v, float64(width)))
 		DrawLine(float32(x), 0, float32(x), float32(fftHeight), lineColor, img)
-		var v = startFreq + float64(x)*hzPerPixel
-		v2, unit := toNotationUnit(float32(v))
-		gc.FillStringAt(fmt.Sprintf("%.2f %sHz", v2, unit), x+10, float64(fftHeight)-10)
+		gc.FillStringAt(formatAxisFrequency(v, step), x+10, float64(fftHeight)-10)
 	}
 	// endregion
+	// region Draw Bookmarks
+	drawBookmarks(gc, img, width)
+	// endregion
 	gc.Restore()
 }
 
 func drawChannelOverlay(gc *draw2dimg.GraphicContext, img *image.RGBA, width int) {
 	if demodulator != nil {
-		var dp = demodulator.GetDemodParams()
-		if dp != nil {
-			var demodParams = dp.(demodcore.FMDemodParams)
-			var channelWidth = demodParams.SignalBandwidth
+		var p = GetChannelParams(demodMode, demodBandwidth)
 
-			var startX = FrequencyToPixelX(centerFreq-(channelWidth/2), float64(width))
-			var endX = FrequencyToPixelX(centerFreq+channelWidth/2, float64(width))
+		var startX = FrequencyToPixelX(vfoFrequency+p.LowCut, float64(width))
+		var endX = FrequencyToPixelX(vfoFrequency+p.HighCut, float64(width))
 
-			for i := -1; i < 1; i++ {
-				DrawLine(float32(startX)+float32(i), 0, float32(startX)+float32(i), fftHeight, color.NRGBA{192, 0, 0, 255}, img)
-				DrawLine(float32(endX)+float32(i), 0, float32(endX)+float32(i), fftHeight, color.NRGBA{192, 0, 0, 255}, img)
-			}
+		for i := -1; i < 1; i++ {
+			DrawLine(float32(startX)+float32(i), 0, float32(startX)+float32(i), fftHeight, color.NRGBA{192, 0, 0, 255}, img)
+			DrawLine(float32(endX)+float32(i), 0, float32(endX)+float32(i), fftHeight, color.NRGBA{192, 0, 0, 255}, img)
 		}
 	}
 }
+
 func combine(c1, c2 color.Color) color.Color {
 	r, g, b, a := c1.RGBA()
 	r2, g2, b2, a2 := c2.RGBA()
@@ -210,21 +352,28 @@ func Gen() {
 	samplesMtx.Lock()
 	localSamples := make([]complex64, _fftSize)
 	copy(localSamples, fftSamples)
+	fftLock.Lock()
+	var settled = fftSamplesRetune >= 0 && uint32(fftSamplesRetune) == retuneCount.Get()
+	fftLock.Unlock()
 
-	if len(window) != len(localSamples) {
-		window = dsp.BlackmanHarris(int(_fftSize), 61)
+	if len(window.Data) != len(localSamples) || window.Type != fftWindowType || window.Beta != kaiserBeta {
+		window = MakeFFTWindow(fftWindowType, int(_fftSize), kaiserBeta)
 	}
+	var _window = window
 	samplesMtx.Unlock()
 
 	for j := 0; j < int(_fftSize); j++ {
 		var s = localSamples[j]
-		var r = real(s) * float32(window[j])
-		var i = imag(s) * float32(window[j])
+		var r = real(s) * float32(_window.Data[j])
+		var i = imag(s) * float32(_window.Data[j])
 		localSamples[j] = complex(r, i)
 	}
-	fftResult := fft.FFT(fftSamples)
+	fftResult := fft.FFT(localSamples)
+	// Levels are corrected by the window coherent gain, so a full scale tone reads 0 dB whatever the window
+	var powerScale = float32(_window.PowerScale())
 
 	fftReal := make([]float32, len(fftResult))
+	instantReal := make([]float32, len(fftResult))
 	if _fftCache == nil || len(_fftCache) != len(fftReal) {
 		_fftCache = make([]float32, len(fftReal))
 		for i := 0; i < len(fftReal); i++ {
@@ -235,8 +384,9 @@ func Gen() {
 	var lastV = float32(0)
 	for i := 0; i < len(fftResult); i++ {
 		// Convert FFT to Power in dB
-		var v = tools.ComplexAbsSquared(fftResult[i]) * float32(1.0/sampleRate)
+		var v = tools.ComplexAbsSquared(fftResult[i]) * powerScale
 		fftReal[i] = float32(10 * math.Log10(float64(v)))
+		instantReal[i] = fftReal[i]
 		fftReal[i] = (_fftCache[i]*(_acc-1) + fftReal[i]) / _acc
 		if tools.IsNaN(fftReal[i]) {
 			fftReal[i] = 0
@@ -257,7 +407,17 @@ func Gen() {
 
 	// endregion
 	// region Draw Image and Save
-	widthScale := float32(len(fftReal)) / float32(imgWidth)
+	var row = waterfallRow{
+		spectrum:        make([]float32, len(fftReal)),
+		centerFrequency: centerFreq,
+		sampleRate:      sampleRate,
+	}
+	var instantRow = row
+	instantRow.spectrum = make([]float32, len(instantReal))
+	for i := range row.spectrum {
+		row.spectrum[i] = fftReal[(i+len(fftReal)/2)%len(fftReal)]
+		instantRow.spectrum[i] = instantReal[(i+len(instantReal)/2)%len(instantReal)]
+	}
 
 	drawLock.Lock()
 	defer drawLock.Unlock()
@@ -269,45 +429,37 @@ func Gen() {
 	var lastX = float32(0)
 	var lastY = float32(0)
 
-	var maxVisible = float64(fftOffset) - float64(0)/float64(fftScale)
-	var minVisible = float64(fftOffset) - float64(fftHeight)/float64(fftScale)
-	var deltaVisible = math.Abs(maxVisible - minVisible)
-	var scale = 256 / deltaVisible
-
-	var wtfBuff = image.NewRGBA(image.Rect(0, 0, imgWidth, 1))
+	var view = currentWaterfallView()
 
-	for i := 0; i < len(fftReal); i++ {
-		var iPos = (i + len(fftReal)/2) % len(fftReal)
-		var s = float32(fftReal[iPos])
+	var hasLast = false
+	for i, s := range spectrumPixels(row, imgWidth) {
+		if tools.IsNaN(s) {
+			hasLast = false
+			continue
+		}
 		var v = float32((fftOffset)-s) * float32(fftScale)
-		var x = float32(i) / widthScale
-		if i != 0 {
+		var x = float32(i)
+		if hasLast {
 			DrawLine(lastX, lastY, x, v, color.NRGBA{R: 0, G: 127, B: 127, A: 255}, img)
 		}
-
-		waterFallZ := (float64(s) - minVisible) * scale
-		if waterFallZ > 255 {
-			waterFallZ = 255
-		} else if waterFallZ < 0 {
-			waterFallZ = 0
-		}
-
-		for i := lastX; i <= x; i++ { // For FFT Width < imgWidth
-			wtfBuff.Set(int(i), 0, waterFallLut[uint8(waterFallZ)])
-		}
-
+		hasLast = true
 		lastX = x
 		lastY = v
 	}
 
-	if waterFallBuffers[0] != nil {
-		if waterFallBuffers[0].Rect.Dx() != wtfBuff.Rect.Dx() { // Clear, wrong dimension
-			waterFallBuffers = make([]*image.RGBA, wtfHeight)
-		}
+	var channel = GetChannelParams(demodMode, demodBandwidth)
+	var measuredRow, averages = averageChannelPower(instantRow, _acc)
+	channelMeasurement = MeasureChannel(measuredRow, averages, _window.ENBW, vfoFrequency+channel.LowCut, vfoFrequency+channel.HighCut)
+	if IsScanning() && settled {
+		// The averaged spectrum lags behind, the scanner needs the latest power
+		updateScanner(MeasureChannel(instantRow, 1, _window.ENBW, vfoFrequency+channel.LowCut, vfoFrequency+channel.HighCut))
 	}
 
-	// Shift the waterfall forward, and add current as first.
-	waterFallBuffers = append([]*image.RGBA{wtfBuff}, waterFallBuffers[:wtfHeight-1]...)
+	updateTraces(instantRow)
+	drawTraces(img)
+
+	lastSpectrumRow = row
+	updateWaterfall(row, view)
 
 	for i := 0; i < len(waterFallBuffers); i++ {
 		line := waterFallBuffers[i]
@@ -316,8 +468,11 @@ func Gen() {
 		}
 	}
 
-	drawGrid(gc, img, int(fftOffset), int(fftScale), imgWidth)
+	drawGrid(gc, img, fftOffset, fftScale, imgWidth)
+	drawBandPlan(gc, img, imgWidth)
+	drawWaterfallTimeTicks(gc, img)
 	drawChannelOverlay(gc, img, imgWidth)
+	drawMarkers(gc)
 	isUpdated = true
 	// endregion
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math"
+)
+
+type FFTWindowType int32
+
+const (
+	WindowRectangular FFTWindowType = iota
+	WindowHann
+	WindowHamming
+	WindowBlackman
+	WindowBlackmanHarris
+	WindowFlatTop
+	WindowKaiser
+)
+
+var fftWindowNames = []string{"Rectangular", "Hann", "Hamming", "Blackman", "Blackman-Harris", "Flat-top", "Kaiser"}
+
+func (w FFTWindowType) String() string {
+	if int(w) < len(fftWindowNames) {
+		return fftWindowNames[w]
+	}
+	return "Unknown"
+}
+
+// Cosine sum coefficients of each window, w[i] = a0 - a1 cos(x) + a2 cos(2x) - a3 cos(3x) + a4 cos(4x)
+var fftWindowCoefficients = map[FFTWindowType][]float64{
+	WindowRectangular:    {1},
+	WindowHann:           {0.5, 0.5},
+	WindowHamming:        {0.54, 0.46},
+	WindowBlackman:       {0.42, 0.5, 0.08},
+	WindowBlackmanHarris: {0.35875, 0.48829, 0.14128, 0.01168},
+	WindowFlatTop:        {0.21557895, 0.41663158, 0.277263158, 0.083578947, 0.006947368},
+}
+
+// FFTWindow holds the window samples and the corrections that keep levels calibrated
+type FFTWindow struct {
+	Type FFTWindowType
+	Beta float64
+	Data []float64
+	// CoherentGain is the window mean, it scales the amplitude of tones
+	CoherentGain float64
+	// ENBW is the equivalent noise bandwidth in bins, it scales the power of noise
+	ENBW float64
+}
+
+func MakeFFTWindow(windowType FFTWindowType, length int, beta float64) *FFTWindow {
+	var w = &FFTWindow{
+		Type: windowType,
+		Beta: beta,
+		Data: make([]float64, length),
+	}
+
+	var denominator = float64(length - 1)
+	if denominator < 1 {
+		denominator = 1
+	}
+
+	for i := range w.Data {
+		if windowType == WindowKaiser {
+			var r = 2*float64(i)/denominator - 1
+			w.Data[i] = besselI0(beta*math.Sqrt(1-r*r)) / besselI0(beta)
+			continue
+		}
+		var x = 2 * math.Pi * float64(i) / denominator
+		var sign = 1.0
+		for k, a := range fftWindowCoefficients[windowType] {
+			w.Data[i] += sign * a * math.Cos(float64(k)*x)
+			sign = -sign
+		}
+	}
+
+	var sum, sumSquared float64
+	for _, v := range w.Data {
+		sum += v
+		sumSquared += v * v
+	}
+	w.CoherentGain = sum / float64(length)
+	w.ENBW = float64(length) * sumSquared / (sum * sum)
+
+	return w
+}
+
+// PowerScale converts |X|^2 of a windowed FFT to the power of a tone relative to full scale
+func (w *FFTWindow) PowerScale() float64 {
+	var sum = w.CoherentGain * float64(len(w.Data))
+	return 1 / (sum * sum)
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind
+func besselI0(x float64) float64 {
+	var sum = 1.0
+	var term = 1.0
+	var halfX = x / 2
+	for k := 1; k < 50; k++ {
+		term *= halfX / float64(k)
+		sum += term * term
+		if term*term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type IQFormat int
+
+const (
+	IQFormatAuto IQFormat = iota
+	IQFormatComplex64
+	IQFormatInt16
+	IQFormatUint8
+	IQFormatWAV
+	IQFormatSigMF
+)
+
+var iqFormatNames = []string{"Auto", "Complex64 (cf32)", "Int16 (cs16)", "Uint8 (cu8)", "WAV", "SigMF"}
+
+// fileSourceBlockSize is the number of samples delivered per callback, except for the end of the file. Must be at least the biggest FFT size.
+const fileSourceBlockSize = 16384
+
+var playbackSpeeds = []float64{0.25, 0.5, 1, 2, 4, 8}
+
+func GuessIQFormat(filename string) IQFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".sigmf-meta", ".sigmf-data":
+		return IQFormatSigMF
+	case ".wav":
+		return IQFormatWAV
+	case ".cu8", ".u8":
+		return IQFormatUint8
+	case ".cs16", ".s16":
+		return IQFormatInt16
+	default:
+		return IQFormatComplex64
+	}
+}
+
+type FileSource struct {
+	sync.Mutex
+
+	filename string
+	format   IQFormat
+	file     *os.File
+
+	// sampleFormat is the format of each I or Q component. Same as format, except for WAV and SigMF files.
+	sampleFormat   IQFormat
+	bytesPerSample int64
+	dataOffset     int64
+	totalSamples   int64
+	position       int64
+
+	sampleRate      float64
+	centerFrequency float64
+	gain            float64
+	cb              SamplesCallback
+	frequencyCb     func(frequency float64)
+	meta            *SigMFMeta
+
+	speed   float64
+	loop    bool
+	paused  bool
+	running bool
+	stopC   chan struct{}
+	doneC   chan struct{}
+
+	// Pacing anchors, reset on every seek / speed change
+	paceStart   time.Time
+	paceSamples int64
+}
+
+func MakeFileSource(filename string, format IQFormat, sampleRate, centerFrequency float64) *FileSource {
+	if format == IQFormatAuto {
+		format = GuessIQFormat(filename)
+	}
+	return &FileSource{
+		filename:        filename,
+		format:          format,
+		sampleRate:      sampleRate,
+		centerFrequency: centerFrequency,
+		speed:           1,
+		loop:            true,
+	}
+}
+
+func (s *FileSource) GetName() string {
+	return fmt.Sprintf("File (%s)", filepath.Base(s.filename))
+}
+
+func (s *FileSource) Open() error {
+	var filename = s.filename
+	s.meta = nil
+
+	if s.format == IQFormatSigMF {
+		meta, err := ReadSigMFMeta(s.filename)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s.filename, err)
+		}
+		s.meta = meta
+		filename = SigMFBasePath(s.filename) + ".sigmf-data"
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	var dataLength = stat.Size()
+	s.dataOffset = 0
+	s.sampleFormat = s.format
+
+	if s.format == IQFormatWAV {
+		info, err := parseWavHeader(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %s", s.filename, err)
+		}
+		s.dataOffset = info.dataOffset
+		dataLength = info.dataLength
+		if dataLength > stat.Size()-s.dataOffset {
+			dataLength = stat.Size() - s.dataOffset
+		}
+		s.sampleRate = float64(info.sampleRate)
+		s.sampleFormat = info.sampleFormat
+		if info.centerFrequency != 0 {
+			s.centerFrequency = info.centerFrequency
+		}
+	}
+
+	if s.meta != nil {
+		s.sampleFormat, err = s.meta.IQFormat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		s.sampleRate = s.meta.Global.SampleRate
+		var capture = s.meta.CaptureAt(0)
+		if capture != nil && capture.Frequency != 0 {
+			s.centerFrequency = capture.Frequency
+		}
+	}
+
+	switch s.sampleFormat {
+	case IQFormatComplex64:
+		s.bytesPerSample = 8
+	case IQFormatInt16:
+		s.bytesPerSample = 4
+	case IQFormatUint8:
+		s.bytesPerSample = 2
+	default:
+		f.Close()
+		return fmt.Errorf("unsupported IQ format")
+	}
+
+	if s.sampleRate <= 0 {
+		f.Close()
+		return fmt.Errorf("invalid sample rate for %s", s.filename)
+	}
+
+	s.file = f
+	s.totalSamples = dataLength / s.bytesPerSample
+	s.position = 0
+
+	if s.totalSamples < fileSourceBlockSize {
+		s.Close()
+		return fmt.Errorf("%s is too short", s.filename)
+	}
+
+	return nil
+}
+
+func (s *FileSource) Close() error {
+	s.Stop()
+	s.Lock()
+	defer s.Unlock()
+	if s.file != nil {
+		err := s.file.Close()
+		s.file = nil
+		return err
+	}
+	return nil
+}
+
+func (s *FileSource) Start() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("file not open")
+	}
+	if s.running {
+		return nil
+	}
+	s.running = true
+	s.stopC = make(chan struct{})
+	s.doneC = make(chan struct{})
+	s.resetPacing()
+	go s.loopFunc(s.stopC, s.doneC)
+	return nil
+}
+
+func (s *FileSource) Stop() error {
+	s.Lock()
+	if !s.running {
+		s.Unlock()
+		return nil
+	}
+	s.running = false
+	close(s.stopC)
+	var doneC = s.doneC
+	s.Unlock()
+	<-doneC
+	return nil
+}
+
+func (s *FileSource) SetCallback(cb SamplesCallback) {
+	s.cb = cb
+}
+
+func (s *FileSource) SetFrequencyCallback(cb func(frequency float64)) {
+	s.frequencyCb = cb
+}
+
+// SetCenterFrequency does not retune anything, it just sets the frequency the recording was made at.
+func (s *FileSource) SetCenterFrequency(frequency float64) error {
+	s.centerFrequency = frequency
+	return nil
+}
+
+func (s *FileSource) GetCenterFrequency() float64 {
+	return s.centerFrequency
+}
+
+func (s *FileSource) SetSampleRate(sampleRate float64) error {
+	if (s.format == IQFormatWAV || s.format == IQFormatSigMF) && s.file != nil && sampleRate != s.sampleRate {
+		return fmt.Errorf("sample rate is fixed by the file metadata (%.0f)", s.sampleRate)
+	}
+	s.Lock()
+	s.sampleRate = sampleRate
+	s.resetPacing()
+	s.Unlock()
+	return nil
+}
+
+func (s *FileSource) GetSampleRate() float64 {
+	return s.sampleRate
+}
+
+func (s *FileSource) SetGain(gain float64) error {
+	s.gain = gain
+	return nil
+}
+
+func (s *FileSource) GetGain() float64 {
+	return s.gain
+}
+
+func (s *FileSource) SetAntenna(antenna int) error {
+	if antenna != 0 {
+		return fmt.Errorf("invalid antenna %d", antenna)
+	}
+	return nil
+}
+
+func (s *FileSource) GetAntenna() int {
+	return 0
+}
+
+func (s *FileSource) GetAntennas() []string {
+	return []string{"File"}
+}
+
+// region Playback Controls
+
+func (s *FileSource) SetPaused(paused bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.paused = paused
+	// Playing again after the end of the file starts over
+	if !paused && s.position >= s.totalSamples {
+		s.position = 0
+	}
+	s.resetPacing()
+}
+
+func (s *FileSource) IsPaused() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.paused
+}
+
+func (s *FileSource) SetLoop(loop bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.loop = loop
+}
+
+func (s *FileSource) IsLooping() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.loop
+}
+
+func (s *FileSource) SetSpeed(speed float64) {
+	if speed < 0.25 {
+		speed = 0.25
+	} else if speed > 8 {
+		speed = 8
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.speed = speed
+	s.resetPacing()
+}
+
+func (s *FileSource) GetSpeed() float64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.speed
+}
+
+func (s *FileSource) Seek(position time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	var sample = int64(position.Seconds() * s.sampleRate)
+	if sample < 0 {
+		sample = 0
+	} else if sample > s.totalSamples-fileSourceBlockSize {
+		sample = s.totalSamples - fileSourceBlockSize
+	}
+	s.position = sample
+	s.resetPacing()
+}
+
+func (s *FileSource) GetPosition() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+	return time.Duration(float64(s.position) / s.sampleRate * float64(time.Second))
+}
+
+func (s *FileSource) GetDuration() time.Duration {
+	return time.Duration(float64(s.totalSamples) / s.sampleRate * float64(time.Second))
+}
+
+// GetSigMFMeta returns the metadata of the recording, or nil if it is not a SigMF recording
+func (s *FileSource) GetSigMFMeta() *SigMFMeta {
+	return s.meta
+}
+
+func (s *FileSource) GetSamplePosition() uint64 {
+	s.Lock()
+	defer s.Unlock()
+	return uint64(s.position)
+}
+
+// endregion
+
+// resetPacing must be called with the lock held
+func (s *FileSource) resetPacing() {
+	s.paceStart = time.Now()
+	s.paceSamples = 0
+}
+
+func (s *FileSource) loopFunc(stopC, doneC chan struct{}) {
+	defer close(doneC)
+	var raw = make([]byte, fileSourceBlockSize*s.bytesPerSample)
+	for {
+		select {
+		case <-stopC:
+			return
+		default:
+		}
+
+		s.Lock()
+		if s.paused {
+			s.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		if s.position >= s.totalSamples {
+			if !s.loop {
+				s.paused = true
+				s.Unlock()
+				continue
+			}
+			s.position = 0
+		}
+
+		// The last block of the file is shorter
+		var count = s.totalSamples - s.position
+		if count > fileSourceBlockSize {
+			count = fileSourceBlockSize
+		}
+
+		var timestamp = uint64(s.position)
+		_, err := s.file.ReadAt(raw[:count*s.bytesPerSample], s.dataOffset+s.position*s.bytesPerSample)
+		if err != nil && err != io.EOF {
+			s.paused = true
+			s.Unlock()
+			log.Printf("Error reading %s: %s\n", s.filename, err)
+			continue
+		}
+		s.position += count
+		s.paceSamples += count
+		var wait = s.paceStart.Add(time.Duration(float64(s.paceSamples) / (s.sampleRate * s.speed) * float64(time.Second)))
+		var frequencyChanged = false
+		if s.meta != nil {
+			var capture = s.meta.CaptureAt(timestamp)
+			if capture != nil && capture.Frequency != 0 && capture.Frequency != s.centerFrequency {
+				s.centerFrequency = capture.Frequency
+				frequencyChanged = true
+			}
+		}
+		s.Unlock()
+
+		if frequencyChanged && s.frequencyCb != nil {
+			s.frequencyCb(s.centerFrequency)
+		}
+
+		var samples = convertIQ(raw[:count*s.bytesPerSample], s.sampleFormat)
+		if s.cb != nil {
+			s.cb(samples, 0, timestamp)
+		}
+
+		select {
+		case <-stopC:
+			return
+		case <-time.After(time.Until(wait)):
+		}
+	}
+}
+
+func convertIQ(raw []byte, format IQFormat) []complex64 {
+	var out []complex64
+	switch format {
+	case IQFormatComplex64:
+		out = make([]complex64, len(raw)/8)
+		for i := range out {
+			var r = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*8:]))
+			var q = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*8+4:]))
+			out[i] = complex(r, q)
+		}
+	case IQFormatInt16:
+		out = make([]complex64, len(raw)/4)
+		for i := range out {
+			var r = float32(int16(binary.LittleEndian.Uint16(raw[i*4:]))) / 32768
+			var q = float32(int16(binary.LittleEndian.Uint16(raw[i*4+2:]))) / 32768
+			out[i] = complex(r, q)
+		}
+	case IQFormatUint8:
+		out = uint8ToComplex(raw)
+	}
+	return out
+}
+
+// region WAV Parser
+
+type wavInfo struct {
+	sampleRate      uint32
+	sampleFormat    IQFormat
+	dataOffset      int64
+	dataLength      int64
+	centerFrequency float64
+}
+
+// wavMaxChunkRead is how much of a fmt or auxi chunk is read, the fields used are all in the first bytes
+const wavMaxChunkRead = 64
+
+// readWavChunk reads at most wavMaxChunkRead bytes of a chunk and skips the rest, so a corrupt size does not allocate it all
+func readWavChunk(f io.ReadSeeker, chunkSize int64) ([]byte, error) {
+	var n = chunkSize
+	if n > wavMaxChunkRead {
+		n = wavMaxChunkRead
+	}
+	var data = make([]byte, n)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(chunkSize-n, io.SeekCurrent); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func parseWavHeader(f io.ReadSeeker) (wavInfo, error) {
+	var info wavInfo
+	var header = make([]byte, 12)
+
+	if _, err := io.ReadFull(f, header); err != nil {
+		return info, err
+	}
+
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return info, fmt.Errorf("not a WAV file")
+	}
+
+	var offset = int64(12)
+	var foundFormat = false
+	var chunkHeader = make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(f, chunkHeader); err != nil {
+			return info, fmt.Errorf("no data chunk found")
+		}
+		offset += 8
+		var chunkId = string(chunkHeader[:4])
+		var chunkSize = int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+
+		switch chunkId {
+		case "fmt ":
+			fmtChunk, err := readWavChunk(f, chunkSize)
+			if err != nil || chunkSize < 16 {
+				return info, fmt.Errorf("invalid fmt chunk")
+			}
+			var audioFormat = binary.LittleEndian.Uint16(fmtChunk[0:])
+			var channels = binary.LittleEndian.Uint16(fmtChunk[2:])
+			var bitsPerSample = binary.LittleEndian.Uint16(fmtChunk[14:])
+			info.sampleRate = binary.LittleEndian.Uint32(fmtChunk[4:])
+
+			if audioFormat == 0xFFFE && chunkSize >= 26 { // WAVE_FORMAT_EXTENSIBLE, real format in the GUID
+				audioFormat = binary.LittleEndian.Uint16(fmtChunk[24:])
+			}
+
+			if channels != 2 {
+				return info, fmt.Errorf("IQ WAV files must have 2 channels, got %d", channels)
+			}
+
+			switch {
+			case audioFormat == 1 && bitsPerSample == 8:
+				info.sampleFormat = IQFormatUint8
+			case audioFormat == 1 && bitsPerSample == 16:
+				info.sampleFormat = IQFormatInt16
+			case audioFormat == 3 && bitsPerSample == 32:
+				info.sampleFormat = IQFormatComplex64
+			default:
+				return info, fmt.Errorf("unsupported WAV format %d with %d bits", audioFormat, bitsPerSample)
+			}
+			foundFormat = true
+		case "auxi":
+			// SpectraVue / HDSDR auxiliary chunk: two SYSTEMTIME (16 bytes each) followed by the center frequency
+			auxi, err := readWavChunk(f, chunkSize)
+			if err != nil {
+				return info, err
+			}
+			if chunkSize >= 36 {
+				info.centerFrequency = float64(binary.LittleEndian.Uint32(auxi[32:]))
+			}
+		case "data":
+			if !foundFormat {
+				return info, fmt.Errorf("data chunk before fmt chunk")
+			}
+			info.dataOffset = offset
+			info.dataLength = chunkSize
+			return info, nil
+		default:
+			if _, err := f.Seek(chunkSize, io.SeekCurrent); err != nil {
+				return info, err
+			}
+		}
+
+		offset += chunkSize
+		if chunkSize%2 == 1 { // Chunks are word aligned
+			if _, err := f.Seek(1, io.SeekCurrent); err != nil {
+				return info, err
+			}
+			offset++
+		}
+	}
+}
+
+// endregion
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commandLine holds the flags that are not settings, they only change how this run behaves
+type commandLine struct {
+	headless bool
+	interval time.Duration
+	count    int
+	out      string
+}
+
+// startupAntenna is the antenna asked by name on the command line, resolved once the source is open
+var startupAntenna = ""
+
+// parseCommandLine reads the flags over the loaded settings. Settings given as flags are for this run only, the file keeps its values.
+func parseCommandLine(args []string) commandLine {
+	var cl commandLine
+	var flags = flag.NewFlagSet("segdsp", flag.ExitOnError)
+
+	var sourceType = flags.String("source", "", "Sample source: lime, file, rtltcp or generator")
+	var deviceIndex = flags.Int("device", 0, "LimeSDR device index")
+	var serial = flags.String("serial", "", "LimeSDR serial number, takes precedence over -device")
+	var fileName = flags.String("file", "", "IQ file to play, implies -source file")
+	var format = flags.String("format", "auto", "IQ file format: auto, cf32, cs16, cu8, wav or sigmf")
+	var loop = flags.Bool("loop", true, "Loop the IQ file")
+	var address = flags.String("address", "", "rtl_tcp server address, implies -source rtltcp")
+	var frequency = flags.String("freq", "", "Frequency to tune, in Hz or with a k, M or G suffix")
+	var rate = flags.String("rate", "", "Sample rate, in Hz or with a k or M suffix")
+	var gain = flags.Float64("gain", 0, "Gain between 0 and 1")
+	var antenna = flags.String("antenna", "", "Antenna name or index")
+	var mode = flags.String("mode", "", "Demodulation mode: "+strings.Join(demodModeNames, ", "))
+	var bandwidth = flags.String("bw", "", "Demodulator bandwidth, in Hz or with a k suffix")
+	var audio = flags.String("audio", "", "Audio output device name or index")
+	var size = flags.Int("fft", 0, "FFT size, a power of two between 128 and 16384")
+
+	flags.BoolVar(&cl.headless, "headless", false, "Render PNG snapshots without opening a window")
+	flags.DurationVar(&cl.interval, "interval", 10*time.Second, "Time between headless snapshots")
+	flags.IntVar(&cl.count, "count", 0, "Number of headless snapshots, 0 runs until interrupted")
+	flags.StringVar(&cl.out, "out", ".", "Directory for timestamped snapshots, or a .png file overwritten on every snapshot")
+
+	_ = flags.Parse(args)
+
+	var s = currentSettings()
+	fileSettings = s
+	var fail = func(format string, args ...interface{}) {
+		log.Fatalf(format+"\n", args...)
+	}
+
+	var sourceSet = false
+	flags.Visit(func(f *flag.Flag) {
+		var err error
+		if _, ok := settingsFlagFields[f.Name]; ok {
+			settingsFlags = append(settingsFlags, f.Name)
+		}
+		switch f.Name {
+		case "source":
+			sourceSet = true
+			s.Source = strings.ToLower(*sourceType)
+			switch s.Source {
+			case "lime", "file", "rtltcp", "generator":
+			case "limesdr":
+				s.Source = "lime"
+			case "rtl_tcp":
+				s.Source = "rtltcp"
+			default:
+				fail("Unknown source %s", *sourceType)
+			}
+		case "device":
+			s.DeviceIndex = *deviceIndex
+		case "serial":
+			s.DeviceSerial = *serial
+		case "file":
+			s.FilePath = *fileName
+		case "format":
+			s.FileFormat, err = parseIQFormat(*format)
+		case "loop":
+			fileSourceLoop = *loop
+		case "address":
+			s.RTLTCPAddress = *address
+		case "freq":
+			s.CenterFrequency, err = parseFrequency(*frequency)
+			s.VFOFrequency = s.CenterFrequency
+		case "rate":
+			s.SampleRate, err = parseFrequency(*rate)
+		case "gain":
+			if *gain < 0 || *gain > 1 {
+				err = fmt.Errorf("gain has to be between 0 and 1")
+			}
+			s.Gain = *gain
+		case "antenna":
+			if index, convErr := strconv.Atoi(*antenna); convErr == nil {
+				s.Antenna = int32(index)
+			} else {
+				startupAntenna = *antenna
+			}
+		case "mode":
+			err = fmt.Errorf("unknown mode %s", *mode)
+			for _, name := range demodModeNames {
+				if strings.EqualFold(name, *mode) {
+					s.Mode = name
+					err = nil
+				}
+			}
+		case "bw":
+			s.Bandwidth, err = parseFrequency(*bandwidth)
+		case "audio":
+			s.AudioDevice = *audio
+		case "fft":
+			if *size < 128 || *size > 16384 || *size&(*size-1) != 0 {
+				err = fmt.Errorf("invalid FFT size %d", *size)
+			}
+			s.FFTSize = int32(*size)
+		}
+		if err != nil {
+			fail("-%s: %s", f.Name, err)
+		}
+	})
+
+	// A file or an address says which source to use
+	if !sourceSet {
+		if *fileName != "" {
+			s.Source = "file"
+			settingsFlags = append(settingsFlags, "source")
+		} else if *address != "" {
+			s.Source = "rtltcp"
+			settingsFlags = append(settingsFlags, "source")
+		}
+	}
+
+	// The bandwidth is only kept when the mode does not change it
+	if *mode != "" && *bandwidth == "" {
+		s.Bandwidth = demodModes[demodModeByName(s.Mode)].defaultBandwidth
+		settingsFlags = append(settingsFlags, "bw")
+	}
+
+	applySettings(s)
+	return cl
+}
+
+// settingsFlagFields copies the settings changed by each flag from one Settings to another
+var settingsFlagFields = map[string]func(to *Settings, from Settings){
+	"source":  func(to *Settings, from Settings) { to.Source = from.Source },
+	"device":  func(to *Settings, from Settings) { to.DeviceIndex = from.DeviceIndex },
+	"serial":  func(to *Settings, from Settings) { to.DeviceSerial = from.DeviceSerial },
+	"file":    func(to *Settings, from Settings) { to.FilePath = from.FilePath },
+	"format":  func(to *Settings, from Settings) { to.FileFormat = from.FileFormat },
+	"address": func(to *Settings, from Settings) { to.RTLTCPAddress = from.RTLTCPAddress },
+	"freq": func(to *Settings, from Settings) {
+		to.CenterFrequency = from.CenterFrequency
+		to.VFOFrequency = from.VFOFrequency
+	},
+	"rate":    func(to *Settings, from Settings) { to.SampleRate = from.SampleRate },
+	"gain":    func(to *Settings, from Settings) { to.Gain = from.Gain },
+	"antenna": func(to *Settings, from Settings) { to.Antenna = from.Antenna },
+	"mode":    func(to *Settings, from Settings) { to.Mode = from.Mode },
+	"bw":      func(to *Settings, from Settings) { to.Bandwidth = from.Bandwidth },
+	"audio":   func(to *Settings, from Settings) { to.AudioDevice = from.AudioDevice },
+	"fft":     func(to *Settings, from Settings) { to.FFTSize = from.FFTSize },
+}
+
+// parseFrequency reads a frequency in Hz with an optional k, M or G suffix (96.9M, 12.5k)
+func parseFrequency(text string) (float64, error) {
+	var original = text
+	text = strings.TrimSpace(text)
+	var multiplier = 1.0
+	if len(text) > 0 {
+		switch text[len(text)-1] {
+		case 'k', 'K':
+			multiplier = 1e3
+		case 'M':
+			multiplier = 1e6
+		case 'G', 'g':
+			multiplier = 1e9
+		}
+	}
+	if multiplier != 1 {
+		text = text[:len(text)-1]
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid frequency %s", original)
+	}
+	return v * multiplier, nil
+}
+
+func parseIQFormat(name string) (int32, error) {
+	switch strings.ToLower(name) {
+	case "auto":
+		return int32(IQFormatAuto), nil
+	case "cf32", "complex64":
+		return int32(IQFormatComplex64), nil
+	case "cs16", "int16":
+		return int32(IQFormatInt16), nil
+	case "cu8", "uint8":
+		return int32(IQFormatUint8), nil
+	case "wav":
+		return int32(IQFormatWAV), nil
+	case "sigmf":
+		return int32(IQFormatSigMF), nil
+	}
+	return 0, fmt.Errorf("unknown format %s", name)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// generatorBlockSize is the number of samples delivered per callback. Must be at least the biggest FFT size.
+const generatorBlockSize = 16384
+
+type SignalType int
+
+const (
+	SignalTone SignalType = iota
+	SignalWBFM
+	SignalAM
+	SignalChirp
+)
+
+var signalTypeNames = []string{"Tone", "WBFM", "AM", "Chirp"}
+
+// GeneratorSignal is one carrier of the GeneratorSource
+type GeneratorSignal struct {
+	Type    SignalType
+	Enabled bool
+	// Offset from the center frequency in Hz
+	Offset float64
+	// Level in dBFS
+	Level float64
+	// AudioFrequency is the modulating tone for WBFM and AM
+	AudioFrequency float64
+	// Deviation is the WBFM peak deviation in Hz
+	Deviation float64
+	// ModulationDepth is the AM modulation index (0 to 1)
+	ModulationDepth float64
+	// ChirpSpan is the swept bandwidth, starting at Offset - ChirpSpan / 2
+	ChirpSpan float64
+	// ChirpPeriod is the sweep duration in seconds
+	ChirpPeriod float64
+
+	phase      float64
+	audioPhase float64
+	pilotPhase float64
+	chirpTime  float64
+}
+
+func (s *GeneratorSignal) String() string {
+	v, unit := toNotationUnit(float32(math.Abs(s.Offset)))
+	var sign = "+"
+	if s.Offset < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%s %s%.2f %sHz", signalTypeNames[s.Type], sign, v, unit)
+}
+
+// GeneratorSource synthesizes test signals over a noise floor, paced at the configured sample rate
+type GeneratorSource struct {
+	sync.Mutex
+
+	signals    []*GeneratorSignal
+	noiseFloor float64
+	rnd        *rand.Rand
+
+	sampleRate      float64
+	centerFrequency float64
+	gain            float64
+	cb              SamplesCallback
+
+	running     bool
+	stopC       chan struct{}
+	doneC       chan struct{}
+	sampleCount uint64
+	paceStart   time.Time
+	paceSamples int64
+}
+
+func MakeGeneratorSource(sampleRate, centerFrequency float64) *GeneratorSource {
+	return &GeneratorSource{
+		sampleRate:      sampleRate,
+		centerFrequency: centerFrequency,
+		gain:            0.5,
+		noiseFloor:      -70,
+		rnd:             rand.New(rand.NewSource(1)),
+		signals: []*GeneratorSignal{
+			{Type: SignalWBFM, Enabled: true, Offset: 0, Level: -20, AudioFrequency: 1000, Deviation: 75e3},
+			{Type: SignalTone, Enabled: true, Offset: sampleRate * 0.3, Level: -30},
+			{Type: SignalAM, Enabled: true, Offset: -sampleRate * 0.2, Level: -35, AudioFrequency: 800, ModulationDepth: 0.8},
+			{Type: SignalTone, Enabled: true, Offset: -sampleRate * 0.35, Level: -50},
+			{Type: SignalTone, Enabled: true, Offset: -sampleRate * 0.34, Level: -55},
+			{Type: SignalChirp, Enabled: false, Offset: sampleRate * 0.15, Level: -40, ChirpSpan: sampleRate * 0.1, ChirpPeriod: 1},
+		},
+	}
+}
+
+func (g *GeneratorSource) GetName() string {
+	return "Signal Generator"
+}
+
+func (g *GeneratorSource) Open() error {
+	if g.sampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate %.0f", g.sampleRate)
+	}
+	return nil
+}
+
+func (g *GeneratorSource) Close() error {
+	return g.Stop()
+}
+
+func (g *GeneratorSource) Start() error {
+	g.Lock()
+	defer g.Unlock()
+	if g.running {
+		return nil
+	}
+	g.running = true
+	g.stopC = make(chan struct{})
+	g.doneC = make(chan struct{})
+	g.paceStart = time.Now()
+	g.paceSamples = 0
+	go g.loopFunc(g.stopC, g.doneC)
+	return nil
+}
+
+func (g *GeneratorSource) Stop() error {
+	g.Lock()
+	if !g.running {
+		g.Unlock()
+		return nil
+	}
+	g.running = false
+	close(g.stopC)
+	var doneC = g.doneC
+	g.Unlock()
+	<-doneC
+	return nil
+}
+
+func (g *GeneratorSource) SetCallback(cb SamplesCallback) {
+	g.cb = cb
+}
+
+// SetCenterFrequency only changes the frequency reported to the application, the signals keep their offsets.
+func (g *GeneratorSource) SetCenterFrequency(frequency float64) error {
+	g.centerFrequency = frequency
+	return nil
+}
+
+func (g *GeneratorSource) GetCenterFrequency() float64 {
+	return g.centerFrequency
+}
+
+func (g *GeneratorSource) SetSampleRate(sampleRate float64) error {
+	if sampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate %.0f", sampleRate)
+	}
+	g.Lock()
+	defer g.Unlock()
+	g.sampleRate = sampleRate
+	g.paceStart = time.Now()
+	g.paceSamples = 0
+	return nil
+}
+
+func (g *GeneratorSource) GetSampleRate() float64 {
+	return g.sampleRate
+}
+
+// SetGain scales all signals and noise from -20 dB (0) to +20 dB (1)
+func (g *GeneratorSource) SetGain(gain float64) error {
+	g.Lock()
+	defer g.Unlock()
+	g.gain = gain
+	return nil
+}
+
+func (g *GeneratorSource) GetGain() float64 {
+	return g.gain
+}
+
+func (g *GeneratorSource) SetAntenna(antenna int) error {
+	if antenna != 0 {
+		return fmt.Errorf("invalid antenna %d", antenna)
+	}
+	return nil
+}
+
+func (g *GeneratorSource) GetAntenna() int {
+	return 0
+}
+
+func (g *GeneratorSource) GetAntennas() []string {
+	return []string{"Synthetic"}
+}
+
+// region Signal Configuration
+
+func (g *GeneratorSource) GetSignals() []*GeneratorSignal {
+	g.Lock()
+	defer g.Unlock()
+	return g.signals
+}
+
+func (g *GeneratorSource) AddSignal(signal *GeneratorSignal) {
+	g.Lock()
+	defer g.Unlock()
+	g.signals = append(g.signals, signal)
+}
+
+// UpdateSignal runs f with the generator locked, so the signal can be changed safely
+func (g *GeneratorSource) UpdateSignal(signal *GeneratorSignal, f func(s *GeneratorSignal)) {
+	g.Lock()
+	defer g.Unlock()
+	f(signal)
+}
+
+func (g *GeneratorSource) SetNoiseFloor(level float64) {
+	g.Lock()
+	defer g.Unlock()
+	g.noiseFloor = level
+}
+
+func (g *GeneratorSource) GetNoiseFloor() float64 {
+	g.Lock()
+	defer g.Unlock()
+	return g.noiseFloor
+}
+
+// endregion
+
+// Generate synthesizes the next n samples
+func (g *GeneratorSource) Generate(n int) []complex64 {
+	g.Lock()
+	defer g.Unlock()
+
+	var out = make([]complex64, n)
+	var gainScale = math.Pow(10, (g.gain-0.5)*40/20)
+	var noiseSigma = math.Sqrt(math.Pow(10, g.noiseFloor/10)/2) * gainScale
+	var dt = 1 / g.sampleRate
+
+	for i := range out {
+		out[i] = complex(float32(g.rnd.NormFloat64()*noiseSigma), float32(g.rnd.NormFloat64()*noiseSigma))
+	}
+
+	for _, s := range g.signals {
+		if !s.Enabled {
+			continue
+		}
+		var amplitude = math.Pow(10, s.Level/20) * gainScale
+		for i := range out {
+			var a = amplitude
+			var freq = s.Offset
+			switch s.Type {
+			case SignalWBFM:
+				// Left channel only carries the tone, so the stereo subcarrier is also present
+				var left = math.Sin(s.audioPhase)
+				var stereoCarrier = math.Sin(2 * s.pilotPhase)
+				var mpx = 0.9*(left/2+left/2*stereoCarrier) + 0.1*math.Sin(s.pilotPhase)
+				freq += s.Deviation * mpx
+				s.audioPhase = math.Mod(s.audioPhase+2*math.Pi*s.AudioFrequency*dt, 2*math.Pi)
+				s.pilotPhase = math.Mod(s.pilotPhase+2*math.Pi*19e3*dt, 2*math.Pi)
+			case SignalAM:
+				a *= (1 + s.ModulationDepth*math.Sin(s.audioPhase)) / (1 + s.ModulationDepth)
+				s.audioPhase = math.Mod(s.audioPhase+2*math.Pi*s.AudioFrequency*dt, 2*math.Pi)
+			case SignalChirp:
+				freq += s.ChirpSpan * (s.chirpTime/s.ChirpPeriod - 0.5)
+				s.chirpTime = math.Mod(s.chirpTime+dt, s.ChirpPeriod)
+			}
+			sin, cos := math.Sincos(s.phase)
+			out[i] += complex(float32(a*cos), float32(a*sin))
+			s.phase = math.Mod(s.phase+2*math.Pi*freq*dt, 2*math.Pi)
+		}
+	}
+
+	g.sampleCount += uint64(n)
+
+	return out
+}
+
+func (g *GeneratorSource) loopFunc(stopC, doneC chan struct{}) {
+	defer close(doneC)
+	for {
+		var timestamp = g.sampleCount
+		var samples = g.Generate(generatorBlockSize)
+
+		g.Lock()
+		g.paceSamples += generatorBlockSize
+		var wait = g.paceStart.Add(time.Duration(float64(g.paceSamples) / g.sampleRate * float64(time.Second)))
+		g.Unlock()
+
+		if g.cb != nil {
+			g.cb(samples, 0, timestamp)
+		}
+
+		select {
+		case <-stopC:
+			return
+		case <-time.After(time.Until(wait)):
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/racerxdl/segdsp/demodcore"
+	"math"
+	"testing"
+)
+
+const generatorTestSampleRate = 1e6
+
+// makeTestGenerator returns a generator with a single signal on the center frequency
+func makeTestGenerator(signal *GeneratorSignal) *GeneratorSource {
+	var g = MakeGeneratorSource(generatorTestSampleRate, 100e6)
+	g.signals = []*GeneratorSignal{signal}
+	g.SetNoiseFloor(-90)
+	return g
+}
+
+// measureTone returns the frequency of a tone from its rising zero crossings, and its RMS level
+func measureTone(audio []float32, sampleRate float64) (float64, float64) {
+	var first, last = -1.0, -1.0
+	var crossings = 0
+	var sum = 0.0
+	for i := 1; i < len(audio); i++ {
+		sum += float64(audio[i]) * float64(audio[i])
+		if audio[i-1] < 0 && audio[i] >= 0 {
+			var t = float64(i-1) + float64(-audio[i-1]/(audio[i]-audio[i-1]))
+			if first < 0 {
+				first = t
+			} else {
+				crossings++
+			}
+			last = t
+		}
+	}
+	var rms = math.Sqrt(sum / float64(len(audio)))
+	if crossings == 0 {
+		return 0, rms
+	}
+	return float64(crossings) * sampleRate / (last - first), rms
+}
+
+func TestGeneratorWBFMDemodulation(t *testing.T) {
+	var g = makeTestGenerator(&GeneratorSignal{Type: SignalWBFM, Enabled: true, Level: -20, AudioFrequency: 1000, Deviation: 75e3})
+	var d = MakeDemodulator(ModeWFM, generatorTestSampleRate, 192e3, 50e-6, false).(*wbfmDemodulator)
+
+	var left, right []float32
+	for i := 0; i < 40; i++ {
+		var out = d.Work(g.Generate(generatorBlockSize)).(StereoDemodData)
+		// The first blocks are the filters and the pilot PLL settling
+		if i >= 20 {
+			left = append(left, out.Left...)
+			right = append(right, out.Right...)
+		}
+	}
+
+	if !d.IsStereo() {
+		t.Fatal("19 kHz pilot not detected")
+	}
+
+	frequency, leftLevel := measureTone(left, audioSampleRate)
+	if math.Abs(frequency-1000) > 5 {
+		t.Errorf("left channel tone is %.1f Hz, expected 1000 Hz", frequency)
+	}
+	if leftLevel < 0.05 {
+		t.Errorf("left channel level is %.3f, too low", leftLevel)
+	}
+
+	// The generator only modulates the left channel
+	_, rightLevel := measureTone(right, audioSampleRate)
+	if rightLevel > leftLevel/10 {
+		t.Errorf("right channel level %.3f is more than a tenth of the left one (%.3f)", rightLevel, leftLevel)
+	}
+}
+
+func TestGeneratorAMDemodulation(t *testing.T) {
+	var g = makeTestGenerator(&GeneratorSignal{Type: SignalAM, Enabled: true, Level: -30, AudioFrequency: 800, ModulationDepth: 0.8})
+	var d = MakeDemodulator(ModeAM, generatorTestSampleRate, 10e3, 0, false)
+
+	var audio []float32
+	for i := 0; i < 20; i++ {
+		var out = d.Work(g.Generate(generatorBlockSize)).(demodcore.DemodData)
+		if i >= 10 {
+			audio = append(audio, out.Data...)
+		}
+	}
+
+	frequency, level := measureTone(audio, audioSampleRate)
+	if math.Abs(frequency-800) > 5 {
+		t.Errorf("AM tone is %.1f Hz, expected 800 Hz", frequency)
+	}
+	if level < 0.05 {
+		t.Errorf("AM audio level is %.3f, too low", level)
+	}
+}
+
+func TestGeneratorWBFMMono(t *testing.T) {
+	var g = makeTestGenerator(&GeneratorSignal{Type: SignalWBFM, Enabled: true, Level: -20, AudioFrequency: 1000, Deviation: 75e3})
+	var d = MakeDemodulator(ModeWFM, generatorTestSampleRate, 192e3, 50e-6, true).(*wbfmDemodulator)
+
+	for i := 0; i < 20; i++ {
+		d.Work(g.Generate(generatorBlockSize))
+	}
+	if d.IsStereo() {
+		t.Error("forced mono demodulator reports stereo")
+	}
+}
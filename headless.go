@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// headless is set when running without a window, no audio is produced and nothing is demodulated
+var headless = false
+
+// runHeadless renders the spectrum and waterfall off-screen and saves PNG snapshots on an interval
+//
+//	segdsp -headless -file capture.sigmf-meta -interval 10s -out reports/
+func runHeadless(cl commandLine) {
+	headless = true
+
+	var src = sourceFactory()
+	err := src.Open()
+	if err != nil {
+		log.Fatalf("Error opening %s: %s\n", src.GetName(), err)
+	}
+
+	attachSource(src)
+	restoreTuning()
+	dspLoaded.Set(true)
+
+	err = source.Start()
+	if err != nil {
+		log.Fatalf("Error starting %s: %s\n", source.GetName(), err)
+	}
+	log.Printf("Rendering %s at %s every %s\n", source.GetName(), formatAxisFrequency(centerFreq, 1), cl.interval)
+
+	exitC := make(chan os.Signal, 1)
+	signal.Notify(exitC, os.Interrupt, syscall.SIGTERM)
+
+	var ticker = time.NewTicker(cl.interval)
+	var saved = 0
+
+loop:
+	for cl.count == 0 || saved < cl.count {
+		select {
+		case <-exitC:
+			break loop
+		case <-ticker.C:
+			name, err := SaveSnapshot(cl.out)
+			if err != nil {
+				log.Printf("Error saving snapshot: %s\n", err)
+				continue
+			}
+			log.Printf("Saved %s\n", name)
+			saved++
+		}
+	}
+
+	ticker.Stop()
+	err = source.Stop()
+	if err != nil {
+		log.Printf("Error stopping %s: %s\n", source.GetName(), err)
+	}
+	err = source.Close()
+	if err != nil {
+		log.Printf("Error closing %s: %s\n", source.GetName(), err)
+	}
+}
+
+// SaveSnapshot writes the current spectrum and waterfall image as PNG, returning the file name
+func SaveSnapshot(out string) (string, error) {
+	var name = out
+	if !strings.EqualFold(filepath.Ext(out), ".png") {
+		name = filepath.Join(out, fmt.Sprintf("segdsp-spectrum-%s-%.0fHz.png", time.Now().Format("20060102-150405"), centerFreq))
+	}
+
+	drawLock.Lock()
+	defer drawLock.Unlock()
+
+	if len(lastSpectrumRow.spectrum) == 0 {
+		return "", fmt.Errorf("no spectrum yet")
+	}
+
+	// Written to a temporary file first so readers of an overwritten snapshot never see half an image
+	var tmpName = name + ".tmp"
+	f, err := os.Create(tmpName)
+	if err != nil {
+		return "", err
+	}
+
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+
+	return name, os.Rename(tmpName, name)
+}
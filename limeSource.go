@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"github.com/myriadrf/limedrv"
+)
+
+type LimeSDRSource struct {
+	deviceIndex int
+	serial      string
+	channel     int
+	dev         *limedrv.LMSDevice
+	cb          SamplesCallback
+
+	centerFrequency float64
+	sampleRate      float64
+	gain            float64
+	lpf             float64
+	antenna         int
+	antennas        []string
+}
+
+func MakeLimeSDRSource(deviceIndex, channel int) *LimeSDRSource {
+	return &LimeSDRSource{
+		deviceIndex:     deviceIndex,
+		channel:         channel,
+		centerFrequency: 96.9e6,
+		sampleRate:      2e6,
+		gain:            0.4,
+		lpf:             10e6,
+	}
+}
+
+// MakeLimeSDRSourceBySerial opens the device with the given serial number, whatever its index
+func MakeLimeSDRSourceBySerial(serial string, channel int) *LimeSDRSource {
+	var s = MakeLimeSDRSource(0, channel)
+	s.serial = serial
+	return s
+}
+
+func (s *LimeSDRSource) GetName() string {
+	return "LimeSDR"
+}
+
+func (s *LimeSDRSource) Open() error {
+	devices := limedrv.GetDevices()
+
+	if len(devices) == 0 {
+		return fmt.Errorf("No devices found")
+	}
+
+	if s.serial != "" {
+		s.deviceIndex = -1
+		for i, d := range devices {
+			if d.Serial == s.serial {
+				s.deviceIndex = i
+			}
+		}
+		if s.deviceIndex < 0 {
+			return fmt.Errorf("No device with serial %s", s.serial)
+		}
+	}
+
+	if s.deviceIndex < 0 || s.deviceIndex >= len(devices) {
+		return fmt.Errorf("Invalid device index %d (%d devices found)", s.deviceIndex, len(devices))
+	}
+
+	s.dev = limedrv.Open(devices[s.deviceIndex])
+
+	if s.channel < 0 || s.channel >= len(s.dev.RXChannels) {
+		s.dev.Close()
+		s.dev = nil
+		return fmt.Errorf("Invalid RX channel %d", s.channel)
+	}
+
+	s.dev.SetCallback(func(data []complex64, channel int, timestamp uint64) {
+		if s.cb != nil {
+			s.cb(data, channel, timestamp)
+		}
+	})
+	s.dev.SetSampleRate(s.sampleRate, 4)
+	s.dev.RXChannels[s.channel].
+		SetAntenna(s.antenna).
+		SetGainNormalized(s.gain).
+		SetLPF(s.lpf).
+		SetCenterFrequency(s.centerFrequency).
+		EnableLPF().
+		Enable()
+
+	var ants = s.dev.RXChannels[s.channel].Antennas
+	s.antennas = make([]string, len(ants))
+	for i := 0; i < len(ants); i++ {
+		s.antennas[i] = ants[i].Name
+	}
+
+	return nil
+}
+
+func (s *LimeSDRSource) Close() error {
+	if s.dev != nil {
+		s.dev.Close()
+		s.dev = nil
+	}
+	return nil
+}
+
+func (s *LimeSDRSource) Start() error {
+	if s.dev == nil {
+		return fmt.Errorf("device not open")
+	}
+	s.dev.Start()
+	return nil
+}
+
+func (s *LimeSDRSource) Stop() error {
+	if s.dev == nil {
+		return fmt.Errorf("device not open")
+	}
+	s.dev.Stop()
+	return nil
+}
+
+func (s *LimeSDRSource) SetCallback(cb SamplesCallback) {
+	s.cb = cb
+}
+
+func (s *LimeSDRSource) SetCenterFrequency(frequency float64) error {
+	s.centerFrequency = frequency
+	if s.dev != nil {
+		s.dev.RXChannels[s.channel].SetCenterFrequency(frequency)
+	}
+	return nil
+}
+
+func (s *LimeSDRSource) GetCenterFrequency() float64 {
+	return s.centerFrequency
+}
+
+func (s *LimeSDRSource) SetSampleRate(sampleRate float64) error {
+	s.sampleRate = sampleRate
+	if s.dev != nil {
+		s.dev.SetSampleRate(sampleRate, 4)
+	}
+	return nil
+}
+
+func (s *LimeSDRSource) GetSampleRate() float64 {
+	return s.sampleRate
+}
+
+func (s *LimeSDRSource) SetGain(gain float64) error {
+	s.gain = gain
+	if s.dev != nil {
+		s.dev.RXChannels[s.channel].SetGainNormalized(gain)
+	}
+	return nil
+}
+
+func (s *LimeSDRSource) GetGain() float64 {
+	return s.gain
+}
+
+func (s *LimeSDRSource) SetAntenna(antenna int) error {
+	if s.antennas != nil && (antenna < 0 || antenna >= len(s.antennas)) {
+		return fmt.Errorf("invalid antenna %d", antenna)
+	}
+	s.antenna = antenna
+	if s.dev != nil {
+		s.dev.RXChannels[s.channel].SetAntenna(antenna)
+	}
+	return nil
+}
+
+func (s *LimeSDRSource) GetAntenna() int {
+	return s.antenna
+}
+
+func (s *LimeSDRSource) GetAntennas() []string {
+	return s.antennas
+}
+
+// SetLPF changes the analog low pass filter bandwidth of the RX channel
+func (s *LimeSDRSource) SetLPF(lpf float64) {
+	s.lpf = lpf
+	if s.dev != nil {
+		s.dev.RXChannels[s.channel].SetLPF(lpf)
+	}
+}
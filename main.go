@@ -31,6 +31,19 @@ func init() {
 
 func main() {
 	//defer profile.Start().Stop()
+	if err := LoadSettings(); err != nil {
+		log.Printf("Error loading settings: %s\n", err)
+	}
+	if err := LoadUserBandPlan(); err != nil {
+		log.Printf("Error loading band plan: %s\n", err)
+	}
+
+	var cl = parseCommandLine(os.Args[1:])
+	if cl.headless {
+		runHeadless(cl)
+		return
+	}
+
 	runtime.LockOSThread()
 	if err := glfw.Init(); err != nil {
 		log.Fatalln(err)
@@ -81,7 +94,7 @@ func main() {
 
 	Gen()
 	frameImg, frameTex = rgbaTex(frameTex, img)
-	go InitializeLimeSDR()
+	go InitializeDSP()
 
 	for {
 		select {
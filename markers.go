@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"github.com/llgcode/draw2d/draw2dimg"
+	"image/color"
+	"math"
+)
+
+const maxMarkers = 8
+
+// markerPeakExcursion is how much a peak has to rise above the valley before it, in dB, to be found by next peak
+const markerPeakExcursion = 3
+
+// Marker is a frequency on the spectrum where the level is read
+type Marker struct {
+	Frequency float64
+}
+
+var markers = make([]*Marker, 0, maxMarkers)
+
+var markerColors = []color.Color{
+	color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+	color.NRGBA{R: 255, G: 220, B: 0, A: 255},
+	color.NRGBA{R: 0, G: 255, B: 128, A: 255},
+	color.NRGBA{R: 255, G: 128, B: 255, A: 255},
+}
+
+// AddMarker places a marker at frequency, returning nil when all markers are in use
+func AddMarker(frequency float64) *Marker {
+	if len(markers) >= maxMarkers {
+		return nil
+	}
+	var m = &Marker{Frequency: frequency}
+	markers = append(markers, m)
+	return m
+}
+
+func RemoveMarker(m *Marker) {
+	for i, v := range markers {
+		if v == m {
+			markers = append(markers[:i], markers[i+1:]...)
+			return
+		}
+	}
+}
+
+func ClearMarkers() {
+	markers = markers[:0]
+}
+
+// lastSpectrum returns the latest averaged spectrum, or false if none was computed yet
+func lastSpectrum() (waterfallRow, bool) {
+	return lastSpectrumRow, len(lastSpectrumRow.spectrum) > 0
+}
+
+func spectrumBin(row waterfallRow, frequency float64) int {
+	var start = row.centerFrequency - row.sampleRate/2
+	return int(math.Floor((frequency - start) / row.sampleRate * float64(len(row.spectrum))))
+}
+
+func binFrequency(row waterfallRow, bin int) float64 {
+	var binWidth = row.sampleRate / float64(len(row.spectrum))
+	return row.centerFrequency - row.sampleRate/2 + (float64(bin)+0.5)*binWidth
+}
+
+// visibleBins is the range of bins inside the visible span
+func visibleBins(row waterfallRow) (int, int) {
+	var first = spectrumBin(row, PixelXToFrequency(0, imgWidth))
+	var last = spectrumBin(row, PixelXToFrequency(imgWidth, imgWidth))
+	return int(math.Max(0, float64(first))), int(math.Min(float64(len(row.spectrum)-1), float64(last)))
+}
+
+// Level returns the marker level in dBFS, false when it is outside the spectrum
+func (m *Marker) Level() (float64, bool) {
+	row, ok := lastSpectrum()
+	if !ok {
+		return 0, false
+	}
+	var bin = spectrumBin(row, m.Frequency)
+	if bin < 0 || bin >= len(row.spectrum) {
+		return 0, false
+	}
+	return float64(row.spectrum[bin]), true
+}
+
+// ToPeak moves the marker to the strongest signal on the visible span
+func (m *Marker) ToPeak() {
+	row, ok := lastSpectrum()
+	if !ok {
+		return
+	}
+	var first, last = visibleBins(row)
+	var peak = first
+	for i := first; i <= last; i++ {
+		if row.spectrum[i] > row.spectrum[peak] {
+			peak = i
+		}
+	}
+	m.Frequency = binFrequency(row, peak)
+}
+
+// NextPeak moves the marker to the next peak to the left (direction < 0) or right (direction > 0)
+func (m *Marker) NextPeak(direction int) {
+	row, ok := lastSpectrum()
+	if !ok {
+		return
+	}
+	if direction < 0 {
+		direction = -1
+	} else {
+		direction = 1
+	}
+
+	var first, last = visibleBins(row)
+	var bin = spectrumBin(row, m.Frequency)
+	var valley = math.Inf(1)
+	var candidate = -1
+
+	for i := bin + direction; i >= first && i <= last; i += direction {
+		var v = float64(row.spectrum[i])
+		if candidate >= 0 {
+			if v > float64(row.spectrum[candidate]) {
+				candidate = i
+				continue
+			}
+			// Peak confirmed once the signal starts falling again
+			break
+		}
+		valley = math.Min(valley, v)
+		if v-valley >= markerPeakExcursion {
+			candidate = i
+		}
+	}
+
+	if candidate >= 0 {
+		m.Frequency = binFrequency(row, candidate)
+	}
+}
+
+func (m *Marker) FrequencyString() string {
+	row, ok := lastSpectrum()
+	var resolution = 1.0
+	if ok {
+		resolution = row.sampleRate / float64(len(row.spectrum))
+	}
+	return formatAxisFrequency(m.Frequency, resolution)
+}
+
+// MarkerDelta returns the frequency and level differences of m relative to reference
+func MarkerDelta(m, reference *Marker) (float64, float64, bool) {
+	l1, ok1 := m.Level()
+	l2, ok2 := reference.Level()
+	return m.Frequency - reference.Frequency, l1 - l2, ok1 && ok2
+}
+
+func drawMarkers(gc *draw2dimg.GraphicContext) {
+	gc.Save()
+	gc.SetFontSize(10)
+	for i, m := range markers {
+		var level, ok = m.Level()
+		if !ok {
+			continue
+		}
+		var x = FrequencyToPixelX(m.Frequency, imgWidth)
+		if x < 0 || x >= imgWidth {
+			continue
+		}
+		var y = math.Max(10, math.Min(fftHeight, (float64(fftOffset)-level)*float64(fftScale)))
+		var c = markerColors[i%len(markerColors)]
+
+		// Triangle pointing down to the marker level
+		gc.SetFillColor(c)
+		gc.MoveTo(x, y)
+		gc.LineTo(x-5, y-9)
+		gc.LineTo(x+5, y-9)
+		gc.Close()
+		gc.Fill()
+
+		gc.FillStringAt(fmt.Sprintf("M%d", i+1), x-6, y-12)
+	}
+	gc.Restore()
+}
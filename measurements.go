@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// occupiedBandwidthRatio is the fraction of the channel power inside the occupied bandwidth
+const occupiedBandwidthRatio = 0.99
+
+// ChannelMeasurement holds the measurements of the demodulated channel made on the latest averaged spectrum
+type ChannelMeasurement struct {
+	Valid bool
+	// ChannelPower is the power integrated between the channel edges, in dBFS
+	ChannelPower float64
+	// OccupiedBandwidth contains 99% of the channel power, in Hz
+	OccupiedBandwidth float64
+	// NoiseFloor is the noise density estimated over the whole captured span, in dBFS/Hz
+	NoiseFloor float64
+	// SNR compares the channel power to the noise in the same bandwidth, in dB
+	SNR float64
+}
+
+var channelMeasurement ChannelMeasurement
+
+// snrFloor is the lowest SNR reported, as a ratio. Noise alone reads around it instead of going to -Inf.
+const snrFloor = 0.01
+
+// channelPowerAverage is the linear power of each bin of channelPowerRow, averaged without the display smoothing
+var channelPowerAverage []float64
+var channelPowerRow waterfallRow
+var channelPowerCount = 0
+
+func GetChannelMeasurement() ChannelMeasurement {
+	return channelMeasurement
+}
+
+// MeasureChannel measures the bins with center between low and high. Bins are calibrated for tones, enbw turns them into noise power.
+// row has to be the linear power average of averages FFTs, without smoothing, so the channel and the noise are measured on the same data.
+func MeasureChannel(row waterfallRow, averages, enbw, low, high float64) ChannelMeasurement {
+	var m ChannelMeasurement
+	var n = len(row.spectrum)
+	if n == 0 || enbw <= 0 {
+		return m
+	}
+	var binWidth = row.sampleRate / float64(n)
+
+	var first = spectrumBin(row, low)
+	var last = spectrumBin(row, high)
+	if first < 0 {
+		first = 0
+	}
+	if last > n-1 {
+		last = n - 1
+	}
+	if last < first {
+		return m
+	}
+
+	var powers = make([]float64, last-first+1)
+	var total = 0.0
+	for i := range powers {
+		powers[i] = math.Pow(10, float64(row.spectrum[first+i])/10) / enbw
+		total += powers[i]
+	}
+
+	// Occupied bandwidth leaves out half of the remaining power on each side
+	var edge = total * (1 - occupiedBandwidthRatio) / 2
+	var lowBin, highBin = 0, len(powers) - 1
+	for sum := 0.0; lowBin < len(powers)-1; lowBin++ {
+		sum += powers[lowBin]
+		if sum > edge {
+			break
+		}
+	}
+	for sum := 0.0; highBin > lowBin; highBin-- {
+		sum += powers[highBin]
+		if sum > edge {
+			break
+		}
+	}
+
+	var noiseDensity = noiseBinPower(row, averages) / enbw / binWidth
+	var channelNoise = noiseDensity * float64(len(powers)) * binWidth
+
+	m.Valid = true
+	m.ChannelPower = 10 * math.Log10(total)
+	m.OccupiedBandwidth = float64(highBin-lowBin+1) * binWidth
+	m.NoiseFloor = 10 * math.Log10(noiseDensity)
+	m.SNR = 10 * math.Log10(math.Max(total-channelNoise, channelNoise*snrFloor)/channelNoise)
+
+	return m
+}
+
+// noiseBinPower estimates the mean noise power of a bin. Most of the span is noise, so the median bin is a robust estimate,
+// but the average of k noise powers is chi-squared with 2k degrees of freedom and its median is below the mean.
+// The Wilson-Hilferty approximation gives the ratio, 0.70 for a single FFT (exactly ln 2) and closer to 1 with averaging.
+func noiseBinPower(row waterfallRow, averages float64) float64 {
+	if len(row.spectrum) == 0 {
+		return math.NaN()
+	}
+	var sorted = append([]float32(nil), row.spectrum...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var dof = 2 * math.Max(1, averages)
+	var medianRatio = math.Pow(1-2/(9*dof), 3)
+	return math.Pow(10, float64(sorted[len(sorted)/2])/10) / medianRatio
+}
+
+// averageChannelPower adds an instantaneous spectrum to the linear power average used for the measurements,
+// returning the average and the number of FFTs it is equivalent to. It restarts when the spectrum layout changes.
+func averageChannelPower(row waterfallRow, acc float32) (waterfallRow, float64) {
+	if len(channelPowerAverage) != len(row.spectrum) || row.centerFrequency != channelPowerRow.centerFrequency || row.sampleRate != channelPowerRow.sampleRate {
+		channelPowerAverage = make([]float64, len(row.spectrum))
+		channelPowerCount = 0
+	}
+	channelPowerCount++
+
+	// Same exponential average as the display, the first FFTs are averaged evenly
+	var alpha = math.Max(1/float64(acc), 1/float64(channelPowerCount))
+	var out = waterfallRow{
+		spectrum:        make([]float32, len(row.spectrum)),
+		centerFrequency: row.centerFrequency,
+		sampleRate:      row.sampleRate,
+	}
+	for i, v := range row.spectrum {
+		channelPowerAverage[i] += (math.Pow(10, float64(v)/10) - channelPowerAverage[i]) * alpha
+		out.spectrum[i] = float32(10 * math.Log10(channelPowerAverage[i]))
+	}
+	channelPowerRow = out
+
+	// An exponential average with factor alpha has the variance of an average of (2 - alpha) / alpha values
+	var averages = math.Min(float64(channelPowerCount), (2-alpha)/alpha)
+	return out, averages
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PaletteStop is a colour of a gradient, at Position between 0 (weakest) and 1 (strongest)
+type PaletteStop struct {
+	Position float64
+	Color    color.NRGBA
+}
+
+// Palette maps waterfall levels to colours
+type Palette struct {
+	Name  string
+	Stops []PaletteStop
+	// File is where the palette was loaded from, empty for the built in ones
+	File string
+	lut  []color.Color
+}
+
+func MakePalette(name string, stops []PaletteStop) (*Palette, error) {
+	if len(stops) < 2 {
+		return nil, fmt.Errorf("palette %s needs at least two colours", name)
+	}
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].Position < stops[j].Position })
+	return &Palette{
+		Name:  name,
+		Stops: stops,
+		lut:   makeGradientLUT(stops),
+	}, nil
+}
+
+// makeGradientLUT linearly interpolates the stops into 256 colours
+func makeGradientLUT(stops []PaletteStop) []color.Color {
+	var lut = make([]color.Color, 256)
+	var s = 0
+	for i := range lut {
+		var p = float64(i) / 255
+		for s < len(stops)-2 && p > stops[s+1].Position {
+			s++
+		}
+		var a, b = stops[s], stops[s+1]
+		var t = 0.0
+		if b.Position > a.Position {
+			t = math.Max(0, math.Min(1, (p-a.Position)/(b.Position-a.Position)))
+		}
+		lut[i] = color.NRGBA{
+			R: uint8(math.Round(float64(a.Color.R) + t*(float64(b.Color.R)-float64(a.Color.R)))),
+			G: uint8(math.Round(float64(a.Color.G) + t*(float64(b.Color.G)-float64(a.Color.G)))),
+			B: uint8(math.Round(float64(a.Color.B) + t*(float64(b.Color.B)-float64(a.Color.B)))),
+			A: 255,
+		}
+	}
+	return lut
+}
+
+func makeGQRXLUT() []color.Color {
+	var lut = make([]color.Color, 0, 256)
+	// From GQRX: https://github.com/csete/gqrx -> qtgui/plotter.cpp
+	for i := 0; i < 256; i++ {
+		if i < 20 {
+			// level 0: black background
+			lut = append(lut, color.NRGBA{A: 255})
+		} else if (i >= 20) && (i < 70) {
+			// level 1: black -> blue
+			lut = append(lut, color.NRGBA{B: uint8(140 * (i - 20) / 50), A: 255})
+		} else if (i >= 70) && (i < 100) {
+			// level 2: blue -> light-blue / greenish
+			lut = append(lut, color.NRGBA{R: uint8(60 * (i - 70) / 30), G: uint8(125 * (i - 70) / 30), B: uint8(115*(i-70)/30 + 140), A: 255})
+		} else if (i >= 100) && (i < 150) {
+			// level 3: light blue -> yellow
+			lut = append(lut, color.NRGBA{R: uint8(195*(i-100)/50 + 60), G: uint8(130*(i-100)/50 + 125), B: uint8(255 - (255 * (i - 100) / 50)), A: 255})
+		} else if (i >= 150) && (i < 250) {
+			// level 4: yellow -> red
+			lut = append(lut, color.NRGBA{R: 255, G: uint8(255 - 255*(i-150)/100), A: 255})
+		} else {
+			// level 5: red -> white
+			lut = append(lut, color.NRGBA{R: 255, G: uint8(255 * (i - 250) / 5), B: uint8(255 * (i - 250) / 5), A: 255})
+		}
+	}
+	return lut
+}
+
+// hexStops builds evenly spaced stops from #rrggbb colours
+func hexStops(colors ...string) []PaletteStop {
+	var stops = make([]PaletteStop, len(colors))
+	for i, c := range colors {
+		v, err := parseHexColor(c)
+		if err != nil {
+			panic(err)
+		}
+		stops[i] = PaletteStop{Position: float64(i) / float64(len(colors)-1), Color: v}
+	}
+	return stops
+}
+
+func parseHexColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid colour %q, expected #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid colour %q, expected #rrggbb", s)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// Viridis, inferno and turbo are sampled from the matplotlib / Google colormaps
+var palettes = []*Palette{
+	{Name: "GQRX", lut: makeGQRXLUT()},
+	{Name: "Grayscale", lut: makeGradientLUT(hexStops("#000000", "#ffffff"))},
+	{Name: "Viridis", lut: makeGradientLUT(hexStops(
+		"#440154", "#482475", "#414487", "#355f8d", "#2a788e", "#21918c",
+		"#22a884", "#44bf70", "#7ad151", "#bddf26", "#fde725"))},
+	{Name: "Inferno", lut: makeGradientLUT(hexStops(
+		"#000004", "#160b39", "#420a68", "#6a176e", "#932667", "#bc3754",
+		"#dd513a", "#f37819", "#fca50a", "#f6d746", "#fcffa4"))},
+	{Name: "Turbo", lut: makeGradientLUT(hexStops(
+		"#30123b", "#4145ab", "#4675ed", "#39a2fc", "#1bcfd4", "#24eca6",
+		"#61fc6c", "#a4fc3b", "#d1e834", "#f3c63a", "#fe9b2d", "#f36315",
+		"#d93806", "#b11901", "#7a0403"))},
+}
+
+var selectedPalette = int32(0)
+
+func paletteNames() []string {
+	var names = make([]string, len(palettes))
+	for i, p := range palettes {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func SetPalette(index int32) {
+	if index < 0 || int(index) >= len(palettes) {
+		return
+	}
+	selectedPalette = index
+	waterFallLut = palettes[index].lut
+}
+
+// LoadPaletteFile reads a JSON or CSV gradient, adds it to the palette list and selects it
+func LoadPaletteFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	var p *Palette
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		p, err = ParsePaletteJSON(name, data)
+	} else {
+		p, err = ParsePaletteCSV(name, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.File = filename
+	palettes = append(palettes, p)
+	SetPalette(int32(len(palettes) - 1))
+	return nil
+}
+
+type paletteJSON struct {
+	Name  string `json:"name"`
+	Stops []struct {
+		Position float64 `json:"position"`
+		Color    string  `json:"color"`
+	} `json:"stops"`
+}
+
+// ParsePaletteJSON reads {"name": "...", "stops": [{"position": 0, "color": "#000000"}, ...]}
+func ParsePaletteJSON(name string, data []byte) (*Palette, error) {
+	var v paletteJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v.Name != "" {
+		name = v.Name
+	}
+	var stops = make([]PaletteStop, len(v.Stops))
+	for i, s := range v.Stops {
+		c, err := parseHexColor(s.Color)
+		if err != nil {
+			return nil, err
+		}
+		stops[i] = PaletteStop{Position: s.Position, Color: c}
+	}
+	return MakePalette(name, stops)
+}
+
+// ParsePaletteCSV reads one stop per line, either "position,#rrggbb" or "position,r,g,b" with 0 to 255 components.
+// Lines starting with # and lines that do not start with a number (like a header) are skipped.
+func ParsePaletteCSV(name string, data []byte) (*Palette, error) {
+	var r = csv.NewReader(strings.NewReader(string(data)))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var stops []PaletteStop
+	for _, record := range records {
+		position, err := strconv.ParseFloat(record[0], 64)
+		if err != nil {
+			continue
+		}
+		var stop = PaletteStop{Position: position}
+		switch len(record) {
+		case 2:
+			stop.Color, err = parseHexColor(record[1])
+			if err != nil {
+				return nil, err
+			}
+		case 4:
+			var rgb [3]uint8
+			for i := range rgb {
+				v, err := strconv.ParseUint(record[i+1], 10, 8)
+				if err != nil {
+					return nil, fmt.Errorf("invalid colour component %q", record[i+1])
+				}
+				rgb[i] = uint8(v)
+			}
+			stop.Color = color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}
+		default:
+			return nil, fmt.Errorf("invalid palette line %q", strings.Join(record, ","))
+		}
+		stops = append(stops, stop)
+	}
+	return MakePalette(name, stops)
+}
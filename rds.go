@@ -0,0 +1,529 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rdsSubcarrier = 57e3
+const rdsBitRate = 1187.5
+const rdsBlockLength = 26
+
+// rdsPolynomial is the generator polynomial of the RDS block code, x^10 + x^8 + x^7 + x^5 + x^4 + x^3 + 1
+const rdsPolynomial = 0x5B9
+
+// Offset words added to each block checkword. A block with no errors has a syndrome equal to its offset word.
+const (
+	rdsOffsetA      = 0x0FC
+	rdsOffsetB      = 0x198
+	rdsOffsetC      = 0x168
+	rdsOffsetCPrime = 0x350
+	rdsOffsetD      = 0x1B4
+)
+
+// rdsSyndromes maps each offset word to the position of its block in the group
+var rdsSyndromes = map[uint32]int{
+	rdsOffsetA:      0,
+	rdsOffsetB:      1,
+	rdsOffsetC:      2,
+	rdsOffsetCPrime: 2,
+	rdsOffsetD:      3,
+}
+
+var rdsBlockOffsets = [4][]uint32{
+	{rdsOffsetA},
+	{rdsOffsetB},
+	{rdsOffsetC, rdsOffsetCPrime},
+	{rdsOffsetD},
+}
+
+// rdsErrorPatterns maps the syndrome of every single bit error to the bit that should be flipped
+var rdsErrorPatterns = map[uint32]uint32{}
+
+func init() {
+	for i := uint(0); i < rdsBlockLength; i++ {
+		rdsErrorPatterns[rdsSyndrome(1<<i)] = 1 << i
+	}
+}
+
+func rdsSyndrome(block uint32) uint32 {
+	for i := rdsBlockLength - 1; i >= 10; i-- {
+		if block&(1<<uint(i)) != 0 {
+			block ^= rdsPolynomial << uint(i-10)
+		}
+	}
+	return block & 0x3FF
+}
+
+var rdsPTYNames = []string{
+	"None", "News", "Current Affairs", "Information", "Sport", "Education", "Drama", "Culture",
+	"Science", "Varied", "Pop Music", "Rock Music", "Easy Listening", "Light Classical", "Serious Classical", "Other Music",
+	"Weather", "Finance", "Children's Programmes", "Social Affairs", "Religion", "Phone-in", "Travel", "Leisure",
+	"Jazz Music", "Country Music", "National Music", "Oldies Music", "Folk Music", "Documentary", "Alarm Test", "Alarm",
+}
+
+var rbdsPTYNames = []string{
+	"None", "News", "Information", "Sports", "Talk", "Rock", "Classic Rock", "Adult Hits",
+	"Soft Rock", "Top 40", "Country", "Oldies", "Soft", "Nostalgia", "Jazz", "Classical",
+	"Rhythm and Blues", "Soft Rhythm and Blues", "Language", "Religious Music", "Religious Talk", "Personality", "Public", "College",
+	"Spanish Talk", "Spanish Music", "Hip Hop", "Unassigned", "Unassigned", "Weather", "Emergency Test", "Emergency",
+}
+
+// rdsCharacters holds the accented letters of the RDS character set from 0x80 to 0x9F
+var rdsCharacters = []rune("áàéèíìóòúùÑÇŞβ¡Ĳâäêëîïôöûüñçşğıĳ")
+
+func rdsCharacter(c byte) rune {
+	if c >= 0x20 && c < 0x7E {
+		return rune(c)
+	}
+	if c >= 0x80 && int(c-0x80) < len(rdsCharacters) {
+		return rdsCharacters[c-0x80]
+	}
+	return ' '
+}
+
+// RBDSCallSign decodes the call sign North American stations encode in their PI code
+func RBDSCallSign(pi uint16) string {
+	var v = int(pi)
+	var prefix string
+	switch {
+	case v >= 4096 && v <= 21671:
+		prefix = "K"
+		v -= 4096
+	case v >= 21672 && v <= 39247:
+		prefix = "W"
+		v -= 21672
+	default:
+		return ""
+	}
+	return fmt.Sprintf("%s%c%c%c", prefix, 'A'+v/676, 'A'+v%676/26, 'A'+v%26)
+}
+
+// RDSInfo is the station metadata decoded from the RDS / RBDS subcarrier
+type RDSInfo struct {
+	Synced bool
+	// Groups is the number of groups decoded since the last reset
+	Groups int
+
+	PI uint16
+	// CallSign is only set in RBDS mode
+	CallSign  string
+	PS        string
+	RadioText string
+	PTY       uint8
+	PTYName   string
+	// TP is the traffic programme flag, TA the traffic announcement flag
+	TP          bool
+	TA          bool
+	MusicSpeech bool
+
+	HasClock  bool
+	ClockTime time.Time
+
+	// AlternativeFrequencies in Hz
+	AlternativeFrequencies []float64
+}
+
+// RDSDecoder finds block synchronization on the RDS bit stream and decodes its groups
+type RDSDecoder struct {
+	sync.Mutex
+
+	rbds bool
+	info RDSInfo
+
+	register   uint32
+	bitCount   int
+	bitPos     int
+	lastOffset int
+	lastPos    int
+	blockIndex int
+	blocks     int
+	badBlocks  int
+
+	group   [4]uint16
+	groupOK [4]bool
+
+	psBuffer   [8]byte
+	psSegments uint8
+	rtBuffer   [64]byte
+	rtAB       bool
+}
+
+func MakeRDSDecoder() *RDSDecoder {
+	var d = &RDSDecoder{}
+	d.reset()
+	return d
+}
+
+// Reset drops all the decoded data, it should be called when tuning to another station
+func (d *RDSDecoder) Reset() {
+	d.Lock()
+	defer d.Unlock()
+	d.reset()
+}
+
+func (d *RDSDecoder) reset() {
+	d.info = RDSInfo{}
+	d.register = 0
+	d.bitCount = 0
+	d.bitPos = 0
+	d.lastOffset = -1
+	d.groupOK = [4]bool{}
+	d.psSegments = 0
+	for i := range d.psBuffer {
+		d.psBuffer[i] = ' '
+	}
+	for i := range d.rtBuffer {
+		d.rtBuffer[i] = ' '
+	}
+}
+
+// SetRBDS selects the North American program type names and call sign decoding
+func (d *RDSDecoder) SetRBDS(rbds bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.rbds = rbds
+}
+
+func (d *RDSDecoder) IsRBDS() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.rbds
+}
+
+func (d *RDSDecoder) GetInfo() RDSInfo {
+	d.Lock()
+	defer d.Unlock()
+	var info = d.info
+	info.AlternativeFrequencies = append([]float64(nil), d.info.AlternativeFrequencies...)
+	if d.rbds {
+		info.PTYName = rbdsPTYNames[info.PTY]
+		info.CallSign = RBDSCallSign(info.PI)
+	} else {
+		info.PTYName = rdsPTYNames[info.PTY]
+	}
+	return info
+}
+
+// Feed receives the differentially decoded data bits, one per byte
+func (d *RDSDecoder) Feed(bits []uint8) {
+	d.Lock()
+	defer d.Unlock()
+	for _, b := range bits {
+		d.register = (d.register<<1 | uint32(b&1)) & (1<<rdsBlockLength - 1)
+		d.bitPos++
+		if d.info.Synced {
+			d.bitCount++
+			if d.bitCount == rdsBlockLength {
+				d.bitCount = 0
+				d.syncedBlock()
+			}
+		} else {
+			d.searchSync()
+		}
+	}
+}
+
+// searchSync looks for two blocks at the right distance and in the right order
+func (d *RDSDecoder) searchSync() {
+	index, ok := rdsSyndromes[rdsSyndrome(d.register)]
+	if !ok {
+		return
+	}
+	var distance = d.bitPos - d.lastPos
+	if d.lastOffset >= 0 && distance%rdsBlockLength == 0 && distance/rdsBlockLength <= 6 &&
+		(d.lastOffset+distance/rdsBlockLength)%4 == index {
+		d.info.Synced = true
+		d.bitCount = 0
+		d.blocks = 0
+		d.badBlocks = 0
+		d.groupOK = [4]bool{}
+		d.blockIndex = index
+		d.storeBlock(d.register >> 10)
+		return
+	}
+	d.lastOffset = index
+	d.lastPos = d.bitPos
+}
+
+func (d *RDSDecoder) syncedBlock() {
+	var syndrome = rdsSyndrome(d.register)
+	var valid = false
+	var data uint32
+	for _, offset := range rdsBlockOffsets[d.blockIndex] {
+		if syndrome == offset {
+			valid = true
+			data = d.register >> 10
+			break
+		}
+	}
+	if !valid {
+		for _, offset := range rdsBlockOffsets[d.blockIndex] {
+			if pattern, ok := rdsErrorPatterns[syndrome^offset]; ok {
+				valid = true
+				data = (d.register ^ pattern) >> 10
+				break
+			}
+		}
+	}
+
+	d.blocks++
+	if !valid {
+		d.badBlocks++
+	}
+	// Sync is lost when most of the last 50 blocks were bad
+	if d.blocks == 50 {
+		if d.badBlocks > 45 {
+			d.info.Synced = false
+			d.lastOffset = -1
+		}
+		d.blocks = 0
+		d.badBlocks = 0
+	}
+
+	if valid {
+		d.storeBlock(data)
+	} else {
+		d.groupOK[d.blockIndex] = false
+		d.nextBlock()
+	}
+}
+
+func (d *RDSDecoder) storeBlock(data uint32) {
+	d.group[d.blockIndex] = uint16(data)
+	d.groupOK[d.blockIndex] = true
+	d.nextBlock()
+}
+
+func (d *RDSDecoder) nextBlock() {
+	if d.blockIndex == 3 {
+		d.processGroup()
+		d.groupOK = [4]bool{}
+	}
+	d.blockIndex = (d.blockIndex + 1) % 4
+}
+
+func (d *RDSDecoder) processGroup() {
+	var g, ok = d.group, d.groupOK
+	if !ok[1] {
+		return
+	}
+
+	var b = g[1]
+	var groupType = b >> 12
+	var versionB = b&0x800 != 0
+
+	if ok[0] {
+		d.info.PI = g[0]
+	} else if versionB && ok[2] {
+		d.info.PI = g[2]
+	}
+	d.info.TP = b&0x400 != 0
+	d.info.PTY = uint8(b >> 5 & 0x1F)
+	d.info.Groups++
+
+	switch groupType {
+	case 0:
+		d.info.TA = b&0x10 != 0
+		d.info.MusicSpeech = b&0x8 != 0
+		if ok[3] {
+			var address = b & 0x3
+			d.psBuffer[address*2] = byte(g[3] >> 8)
+			d.psBuffer[address*2+1] = byte(g[3])
+			d.psSegments |= 1 << address
+			if d.psSegments == 0xF {
+				d.info.PS = rdsString(d.psBuffer[:])
+				d.psSegments = 0
+			}
+		}
+		if !versionB && ok[2] {
+			d.addAlternativeFrequencies(byte(g[2]>>8), byte(g[2]))
+		}
+	case 2:
+		var ab = b&0x10 != 0
+		if ab != d.rtAB {
+			d.rtAB = ab
+			for i := range d.rtBuffer {
+				d.rtBuffer[i] = ' '
+			}
+		}
+		var address = b & 0xF
+		if !versionB && ok[2] && ok[3] {
+			d.rtBuffer[address*4] = byte(g[2] >> 8)
+			d.rtBuffer[address*4+1] = byte(g[2])
+			d.rtBuffer[address*4+2] = byte(g[3] >> 8)
+			d.rtBuffer[address*4+3] = byte(g[3])
+		} else if versionB && ok[3] {
+			d.rtBuffer[address*2] = byte(g[3] >> 8)
+			d.rtBuffer[address*2+1] = byte(g[3])
+		}
+		d.info.RadioText = rdsString(d.rtBuffer[:])
+	case 4:
+		if !versionB && ok[2] && ok[3] {
+			d.decodeClock(b, g[2], g[3])
+		}
+	}
+}
+
+func (d *RDSDecoder) addAlternativeFrequencies(a, b byte) {
+	// 250 announces that the next code is a LF / MF frequency, which is not supported
+	if a == 250 {
+		return
+	}
+	for _, code := range []byte{a, b} {
+		if code < 1 || code > 204 {
+			continue
+		}
+		var frequency = 87.5e6 + float64(code)*100e3
+		var found = false
+		for _, v := range d.info.AlternativeFrequencies {
+			if v == frequency {
+				found = true
+				break
+			}
+		}
+		if !found {
+			d.info.AlternativeFrequencies = append(d.info.AlternativeFrequencies, frequency)
+			sort.Float64s(d.info.AlternativeFrequencies)
+		}
+	}
+}
+
+func (d *RDSDecoder) decodeClock(b, c, dd uint16) {
+	var mjd = float64(int(b&0x3)<<15 | int(c>>1))
+	var hour = int(c&1)<<4 | int(dd>>12)
+	var minute = int(dd>>6) & 0x3F
+	var offset = int(dd&0x1F) * 30 * 60
+	if dd&0x20 != 0 {
+		offset = -offset
+	}
+
+	// Modified Julian Date conversion from the RDS standard, annex G
+	var y = math.Floor((mjd - 15078.2) / 365.25)
+	var m = math.Floor((mjd - 14956.1 - math.Floor(y*365.25)) / 30.6001)
+	var day = int(mjd - 14956 - math.Floor(y*365.25) - math.Floor(m*30.6001))
+	var k = 0.0
+	if m == 14 || m == 15 {
+		k = 1
+	}
+	var year = int(y + k + 1900)
+	var month = int(m - 1 - k*12)
+
+	if hour > 23 || minute > 59 || month < 1 || month > 12 || day < 1 || day > 31 {
+		return
+	}
+
+	var t = time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.UTC)
+	d.info.ClockTime = t.In(time.FixedZone("", offset))
+	d.info.HasClock = true
+}
+
+func rdsString(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		if c == 0x0D {
+			break
+		}
+		b.WriteRune(rdsCharacter(c))
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// region Demodulation
+
+// rdsMinMpxRate is the lowest mpx sample rate that still holds the RDS subcarrier
+const rdsMinMpxRate = 2 * (rdsSubcarrier + 3e3)
+
+// rdsDemodulator recovers the RDS bits from the FM multiplex, using the pilot phase as carrier reference
+type rdsDemodulator struct {
+	decimator *complexFirFilter
+	matched   *complexFirFilter
+
+	carrierAvg   complex128
+	carrierCoeff float64
+	carrierPhase float64
+
+	bitPhase float64
+	bitStep  float64
+	energy   []float64
+	bestBin  int
+	lastBin  int
+	lastBit  uint8
+}
+
+func makeRDSDemodulator(mpxRate float64) *rdsDemodulator {
+	var decimation = int(math.Max(1, math.Floor(mpxRate/(rdsBitRate*16))))
+	var rate = mpxRate / float64(decimation)
+	var samplesPerBit = rate / rdsBitRate
+
+	// Biphase symbols are a half bit up followed by a half bit down
+	var matched = make([]float32, int(math.Round(samplesPerBit)))
+	for i := range matched {
+		if i < len(matched)/2 {
+			matched[i] = 1 / float32(len(matched))
+		} else {
+			matched[i] = -1 / float32(len(matched))
+		}
+	}
+
+	return &rdsDemodulator{
+		decimator:    makeComplexFirFilter(makeLowPassTaps(1, mpxRate, 2.4e3, 2e3), decimation),
+		matched:      makeComplexFirFilter(matched, 1),
+		carrierCoeff: 1 - math.Exp(-1/(rate*0.05)),
+		bitStep:      rdsBitRate / rate,
+		energy:       make([]float64, int(math.Min(16, math.Floor(samplesPerBit)))),
+	}
+}
+
+// Work takes the mpx signal and the 19 kHz pilot phase of each sample, returning the decoded bits
+func (r *rdsDemodulator) Work(mpx []float32, pilotPhases []float64) []uint8 {
+	var mixed = make([]complex64, len(mpx))
+	for i, v := range mpx {
+		var sin, cos = math.Sincos(3 * pilotPhases[i])
+		mixed[i] = complex(v*float32(cos), -v*float32(sin))
+	}
+
+	var iq = r.matched.Work(r.decimator.Work(mixed))
+	var bits = make([]uint8, 0, int(float64(len(iq))*r.bitStep)+1)
+	var bins = len(r.energy)
+
+	for _, v := range iq {
+		// The RDS carrier phase against the pilot harmonic is unknown, BPSK squared gives it back with a 180 degree ambiguity
+		var z = complex128(v)
+		r.carrierAvg += (z*z - r.carrierAvg) * complex(r.carrierCoeff, 0)
+		var phase = cmplx.Phase(r.carrierAvg) / 2
+		phase += math.Pi * math.Round((r.carrierPhase-phase)/math.Pi)
+		r.carrierPhase = phase
+		var y = real(z * cmplx.Rect(1, -phase))
+
+		// Bit timing is taken from the point of the bit period where the matched filter has the most energy
+		var bin = int(r.bitPhase * float64(bins))
+		r.energy[bin] += (math.Abs(y) - r.energy[bin]) * 0.05
+		if bin != r.lastBin && bin == r.bestBin {
+			var bit = uint8(0)
+			if y > 0 {
+				bit = 1
+			}
+			bits = append(bits, bit^r.lastBit)
+			r.lastBit = bit
+
+			for i, e := range r.energy {
+				if e > r.energy[r.bestBin]*1.1 {
+					r.bestBin = i
+				}
+			}
+		}
+		r.lastBin = bin
+		r.bitPhase += r.bitStep
+		r.bitPhase -= math.Floor(r.bitPhase)
+	}
+
+	return bits
+}
+
+// endregion
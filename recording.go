@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var recorder *SigMFRecorder
+var recorderMtx = sync.Mutex{}
+var recordingDir = "."
+
+func IsRecording() bool {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	return recorder != nil
+}
+
+func StartRecording() error {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	if recorder != nil || source == nil {
+		return nil
+	}
+
+	var name = fmt.Sprintf("segdsp-%s-%.0fHz", time.Now().Format("20060102-150405"), centerFreq)
+	var basePath = filepath.Join(recordingDir, name)
+
+	r, err := StartSigMFRecording(basePath, sampleRate, centerFreq, gain, currentAntennaName(), source.GetName())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Recording IQ to %s\n", basePath)
+	recorder = r
+	return nil
+}
+
+func StopRecording() {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	if recorder == nil {
+		return
+	}
+
+	err := recorder.Close()
+	if err != nil {
+		log.Printf("Error closing recording %s: %s\n", recorder.GetBasePath(), err)
+	} else {
+		log.Printf("Recording saved to %s\n", recorder.GetBasePath())
+	}
+	recorder = nil
+}
+
+func recordSamples(data []complex64) {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	if recorder != nil {
+		err := recorder.Write(data)
+		if err != nil {
+			log.Printf("Error writing recording: %s\n", err)
+			recorder.Close()
+			recorder = nil
+		}
+	}
+}
+
+// updateRecordingParams should be called every time the radio is retuned
+func updateRecordingParams() {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	if recorder != nil {
+		recorder.UpdateParams(centerFreq, gain, currentAntennaName())
+	}
+}
+
+func AnnotateRecording(label, comment string) {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	if recorder != nil {
+		recorder.Annotate(label, comment, 0)
+	}
+}
+
+func currentAntennaName() string {
+	if int(antenna) < len(antennaList) {
+		return antennaList[antenna]
+	}
+	return ""
+}
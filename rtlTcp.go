@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// region rtl_tcp Protocol
+
+const rtlTcpMagic = "RTL0"
+const rtlTcpHeaderSize = 12
+const rtlTcpCommandSize = 5
+
+const (
+	rtlTcpCmdSetFrequency      = 0x01
+	rtlTcpCmdSetSampleRate     = 0x02
+	rtlTcpCmdSetGainMode       = 0x03
+	rtlTcpCmdSetGain           = 0x04
+	rtlTcpCmdSetFreqCorrection = 0x05
+	rtlTcpCmdSetIfGain         = 0x06
+	rtlTcpCmdSetTestMode       = 0x07
+	rtlTcpCmdSetAGCMode        = 0x08
+	rtlTcpCmdSetDirectSampling = 0x09
+	rtlTcpCmdSetOffsetTuning   = 0x0A
+	rtlTcpCmdSetRtlXtal        = 0x0B
+	rtlTcpCmdSetTunerXtal      = 0x0C
+	rtlTcpCmdSetGainByIndex    = 0x0D
+	rtlTcpCmdSetBiasTee        = 0x0E
+)
+
+const (
+	rtlTunerUnknown = iota
+	rtlTunerE4000
+	rtlTunerFC0012
+	rtlTunerFC0013
+	rtlTunerFC2580
+	rtlTunerR820T
+	rtlTunerR828D
+)
+
+var rtlTunerNames = []string{"Unknown", "E4000", "FC0012", "FC0013", "FC2580", "R820T", "R828D"}
+
+// Gain steps in tenths of dB for each tuner, from librtlsdr
+var rtlTunerGains = map[uint32][]int32{
+	rtlTunerE4000:  {-10, 15, 40, 65, 90, 115, 140, 165, 190, 215, 240, 290, 340, 420},
+	rtlTunerFC0012: {-99, -40, 71, 179, 192},
+	rtlTunerFC0013: {-99, -73, -65, -63, -60, -58, -54, 58, 61, 63, 65, 67, 68, 70, 71, 179, 181, 182, 184, 186, 188, 191, 197},
+	rtlTunerFC2580: {0},
+	rtlTunerR820T:  {0, 9, 14, 27, 37, 77, 87, 125, 144, 157, 166, 197, 207, 229, 254, 280, 297, 328, 338, 364, 372, 386, 402, 421, 434, 439, 445, 480, 496},
+	rtlTunerR828D:  {0, 9, 14, 27, 37, 77, 87, 125, 144, 157, 166, 197, 207, 229, 254, 280, 297, 328, 338, 364, 372, 386, 402, 421, 434, 439, 445, 480, 496},
+}
+
+type RTLTCPDongleInfo struct {
+	TunerType uint32
+	GainCount uint32
+}
+
+func (i RTLTCPDongleInfo) TunerName() string {
+	if int(i.TunerType) < len(rtlTunerNames) {
+		return rtlTunerNames[i.TunerType]
+	}
+	return rtlTunerNames[rtlTunerUnknown]
+}
+
+func (i RTLTCPDongleInfo) Encode() []byte {
+	var buff = make([]byte, rtlTcpHeaderSize)
+	copy(buff, rtlTcpMagic)
+	binary.BigEndian.PutUint32(buff[4:], i.TunerType)
+	binary.BigEndian.PutUint32(buff[8:], i.GainCount)
+	return buff
+}
+
+func ParseRTLTCPDongleInfo(data []byte) (RTLTCPDongleInfo, error) {
+	var info RTLTCPDongleInfo
+	if len(data) < rtlTcpHeaderSize || string(data[:4]) != rtlTcpMagic {
+		return info, fmt.Errorf("invalid rtl_tcp header")
+	}
+	info.TunerType = binary.BigEndian.Uint32(data[4:])
+	info.GainCount = binary.BigEndian.Uint32(data[8:])
+	return info, nil
+}
+
+func EncodeRTLTCPCommand(command uint8, param uint32) []byte {
+	var buff = make([]byte, rtlTcpCommandSize)
+	buff[0] = command
+	binary.BigEndian.PutUint32(buff[1:], param)
+	return buff
+}
+
+func DecodeRTLTCPCommand(data []byte) (command uint8, param uint32) {
+	return data[0], binary.BigEndian.Uint32(data[1:])
+}
+
+// rtlGainIndex converts a normalized gain (0 to 1) to an index in the gain table
+func rtlGainIndex(gain float64, gainCount uint32) uint32 {
+	if gainCount == 0 {
+		return 0
+	}
+	if gain < 0 {
+		gain = 0
+	} else if gain > 1 {
+		gain = 1
+	}
+	return uint32(math.Round(gain * float64(gainCount-1)))
+}
+
+// rtlNormalizedGain converts a gain in tenths of dB to the closest normalized gain (0 to 1) of the tuner
+func rtlNormalizedGain(tenthsDb int32, tunerType uint32) float64 {
+	var gains = rtlTunerGains[tunerType]
+	if len(gains) < 2 {
+		return 0
+	}
+	var best = 0
+	for i, g := range gains {
+		if math.Abs(float64(g-tenthsDb)) < math.Abs(float64(gains[best]-tenthsDb)) {
+			best = i
+		}
+	}
+	return float64(best) / float64(len(gains)-1)
+}
+
+// endregion
+// region Sample Conversion
+
+func uint8ToComplex(data []byte) []complex64 {
+	var out = make([]complex64, len(data)/2)
+	for i := range out {
+		out[i] = complex((float32(data[i*2])-127.5)/127.5, (float32(data[i*2+1])-127.5)/127.5)
+	}
+	return out
+}
+
+func complexToUint8(data []complex64, out []byte) []byte {
+	if cap(out) < len(data)*2 {
+		out = make([]byte, len(data)*2)
+	}
+	out = out[:len(data)*2]
+	for i, v := range data {
+		out[i*2] = floatToUint8(real(v))
+		out[i*2+1] = floatToUint8(imag(v))
+	}
+	return out
+}
+
+func floatToUint8(v float32) uint8 {
+	var z = v*127.5 + 127.5
+	if z < 0 {
+		return 0
+	} else if z > 255 {
+		return 255
+	}
+	return uint8(z + 0.5)
+}
+
+// endregion
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// rtlTcpClientQueueSize is how many sample blocks can be waiting for a slow client before they start being dropped
+const rtlTcpClientQueueSize = 64
+
+type RTLTCPCommandHandler func(command uint8, param uint32)
+
+// RTLTCPServer exposes samples fed to it through the rtl_tcp protocol. It announces itself as a R820T tuner.
+type RTLTCPServer struct {
+	sync.Mutex
+
+	address  string
+	listener net.Listener
+	clients  map[*rtlTcpClient]struct{}
+	handler  RTLTCPCommandHandler
+	info     RTLTCPDongleInfo
+	buff     []byte
+}
+
+type rtlTcpClient struct {
+	conn    net.Conn
+	samples chan []byte
+}
+
+func MakeRTLTCPServer(address string, handler RTLTCPCommandHandler) *RTLTCPServer {
+	return &RTLTCPServer{
+		address: address,
+		clients: make(map[*rtlTcpClient]struct{}),
+		handler: handler,
+		info: RTLTCPDongleInfo{
+			TunerType: rtlTunerR820T,
+			GainCount: uint32(len(rtlTunerGains[rtlTunerR820T])),
+		},
+	}
+}
+
+func (s *RTLTCPServer) GetAddress() string {
+	s.Lock()
+	defer s.Unlock()
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.address
+}
+
+func (s *RTLTCPServer) Start() error {
+	l, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.listener = l
+	s.Unlock()
+
+	log.Printf("rtl_tcp server listening at %s\n", l.Addr())
+	go s.acceptLoop(l)
+
+	return nil
+}
+
+func (s *RTLTCPServer) Stop() {
+	s.Lock()
+	defer s.Unlock()
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	for c := range s.clients {
+		c.conn.Close()
+		close(c.samples)
+		delete(s.clients, c)
+	}
+}
+
+func (s *RTLTCPServer) ClientCount() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.clients)
+}
+
+// Feed sends samples to all connected clients. Clients that are too slow lose samples instead of blocking the DSP.
+func (s *RTLTCPServer) Feed(data []complex64) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+
+	s.buff = complexToUint8(data, s.buff)
+
+	for c := range s.clients {
+		var block = make([]byte, len(s.buff))
+		copy(block, s.buff)
+		select {
+		case c.samples <- block:
+		default:
+		}
+	}
+}
+
+func (s *RTLTCPServer) acceptLoop(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		var c = &rtlTcpClient{
+			conn:    conn,
+			samples: make(chan []byte, rtlTcpClientQueueSize),
+		}
+
+		_, err = conn.Write(s.info.Encode())
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		s.Lock()
+		if s.listener != l {
+			// Stopped while the client was connecting
+			s.Unlock()
+			conn.Close()
+			return
+		}
+		s.clients[c] = struct{}{}
+		s.Unlock()
+
+		log.Printf("rtl_tcp client connected from %s\n", conn.RemoteAddr())
+
+		go s.clientWriter(c)
+		go s.clientReader(c)
+	}
+}
+
+func (s *RTLTCPServer) removeClient(c *rtlTcpClient) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.clients[c]; ok {
+		log.Printf("rtl_tcp client %s disconnected\n", c.conn.RemoteAddr())
+		c.conn.Close()
+		close(c.samples)
+		delete(s.clients, c)
+	}
+}
+
+func (s *RTLTCPServer) clientWriter(c *rtlTcpClient) {
+	for block := range c.samples {
+		_, err := c.conn.Write(block)
+		if err != nil {
+			s.removeClient(c)
+			return
+		}
+	}
+}
+
+func (s *RTLTCPServer) clientReader(c *rtlTcpClient) {
+	var buff = make([]byte, rtlTcpCommandSize)
+	for {
+		_, err := io.ReadFull(c.conn, buff)
+		if err != nil {
+			s.removeClient(c)
+			return
+		}
+		command, param := DecodeRTLTCPCommand(buff)
+		if s.handler != nil {
+			s.handler(command, param)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// rtlTcpBlockSize is the number of samples delivered per callback. Must be at least the biggest FFT size.
+const rtlTcpBlockSize = 16384
+
+// RTLTCPSource receives samples from a remote rtl_tcp server
+type RTLTCPSource struct {
+	sync.Mutex
+
+	address string
+	conn    net.Conn
+	info    RTLTCPDongleInfo
+	cb      SamplesCallback
+
+	centerFrequency float64
+	sampleRate      float64
+	gain            float64
+	autoGain        bool
+	agc             bool
+	ppm             int32
+
+	running bool
+	doneC   chan struct{}
+}
+
+func MakeRTLTCPSource(address string) *RTLTCPSource {
+	return &RTLTCPSource{
+		address:         address,
+		centerFrequency: 96.9e6,
+		sampleRate:      2.048e6,
+		gain:            0.5,
+	}
+}
+
+func (s *RTLTCPSource) GetName() string {
+	return fmt.Sprintf("rtl_tcp (%s)", s.address)
+}
+
+func (s *RTLTCPSource) Open() error {
+	conn, err := net.DialTimeout("tcp", s.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	var header = make([]byte, rtlTcpHeaderSize)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error reading rtl_tcp header: %s", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	info, err := ParseRTLTCPDongleInfo(header)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.conn = conn
+	s.info = info
+
+	log.Printf("Connected to rtl_tcp at %s (Tuner %s, %d gains)\n", s.address, info.TunerName(), info.GainCount)
+
+	var commands = [][]byte{
+		EncodeRTLTCPCommand(rtlTcpCmdSetSampleRate, uint32(s.sampleRate)),
+		EncodeRTLTCPCommand(rtlTcpCmdSetFrequency, uint32(s.centerFrequency)),
+		EncodeRTLTCPCommand(rtlTcpCmdSetFreqCorrection, uint32(s.ppm)),
+		EncodeRTLTCPCommand(rtlTcpCmdSetAGCMode, boolToUint32(s.agc)),
+		EncodeRTLTCPCommand(rtlTcpCmdSetGainMode, boolToUint32(!s.autoGain)),
+	}
+	if !s.autoGain {
+		commands = append(commands, EncodeRTLTCPCommand(rtlTcpCmdSetGainByIndex, rtlGainIndex(s.gain, s.info.GainCount)))
+	}
+	for _, cmd := range commands {
+		if _, err := conn.Write(cmd); err != nil {
+			conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+
+	// rtl_tcp streams as soon as we connect, so the socket is always drained and the samples are dropped while stopped.
+	s.doneC = make(chan struct{})
+	go s.readLoop(conn, s.doneC)
+
+	return nil
+}
+
+func (s *RTLTCPSource) Close() error {
+	s.Lock()
+	var conn = s.conn
+	var doneC = s.doneC
+	s.conn = nil
+	s.running = false
+	s.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	err := conn.Close()
+	<-doneC
+	return err
+}
+
+func (s *RTLTCPSource) Start() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	s.running = true
+	return nil
+}
+
+func (s *RTLTCPSource) Stop() error {
+	s.Lock()
+	defer s.Unlock()
+	s.running = false
+	return nil
+}
+
+func (s *RTLTCPSource) SetCallback(cb SamplesCallback) {
+	s.cb = cb
+}
+
+func (s *RTLTCPSource) sendCommand(command uint8, param uint32) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	_, err := s.conn.Write(EncodeRTLTCPCommand(command, param))
+	return err
+}
+
+func (s *RTLTCPSource) SetCenterFrequency(frequency float64) error {
+	s.centerFrequency = frequency
+	return s.sendCommand(rtlTcpCmdSetFrequency, uint32(frequency))
+}
+
+func (s *RTLTCPSource) GetCenterFrequency() float64 {
+	return s.centerFrequency
+}
+
+func (s *RTLTCPSource) SetSampleRate(sampleRate float64) error {
+	// Valid RTL2832U sample rates, from librtlsdr
+	if (sampleRate <= 225000) || (sampleRate > 3200000) || (sampleRate > 300000 && sampleRate <= 900000) {
+		return fmt.Errorf("invalid sample rate for rtl-sdr: %.0f", sampleRate)
+	}
+	s.sampleRate = sampleRate
+	return s.sendCommand(rtlTcpCmdSetSampleRate, uint32(sampleRate))
+}
+
+func (s *RTLTCPSource) GetSampleRate() float64 {
+	return s.sampleRate
+}
+
+func (s *RTLTCPSource) SetGain(gain float64) error {
+	s.gain = gain
+	if s.autoGain {
+		return nil
+	}
+	return s.sendCommand(rtlTcpCmdSetGainByIndex, rtlGainIndex(gain, s.info.GainCount))
+}
+
+func (s *RTLTCPSource) GetGain() float64 {
+	return s.gain
+}
+
+func (s *RTLTCPSource) SetAntenna(antenna int) error {
+	if antenna != 0 {
+		return fmt.Errorf("invalid antenna %d", antenna)
+	}
+	return nil
+}
+
+func (s *RTLTCPSource) GetAntenna() int {
+	return 0
+}
+
+func (s *RTLTCPSource) GetAntennas() []string {
+	return []string{"RF"}
+}
+
+// region rtl-sdr specific controls
+
+func (s *RTLTCPSource) GetDongleInfo() RTLTCPDongleInfo {
+	return s.info
+}
+
+// SetAutoGain enables the tuner automatic gain. When disabled, the gain set by SetGain is used.
+func (s *RTLTCPSource) SetAutoGain(autoGain bool) error {
+	s.autoGain = autoGain
+	err := s.sendCommand(rtlTcpCmdSetGainMode, boolToUint32(!autoGain))
+	if err != nil || autoGain {
+		return err
+	}
+	return s.sendCommand(rtlTcpCmdSetGainByIndex, rtlGainIndex(s.gain, s.info.GainCount))
+}
+
+func (s *RTLTCPSource) IsAutoGain() bool {
+	return s.autoGain
+}
+
+// SetAGC enables the RTL2832U digital AGC
+func (s *RTLTCPSource) SetAGC(agc bool) error {
+	s.agc = agc
+	return s.sendCommand(rtlTcpCmdSetAGCMode, boolToUint32(agc))
+}
+
+func (s *RTLTCPSource) IsAGC() bool {
+	return s.agc
+}
+
+func (s *RTLTCPSource) SetPPM(ppm int32) error {
+	s.ppm = ppm
+	return s.sendCommand(rtlTcpCmdSetFreqCorrection, uint32(ppm))
+}
+
+func (s *RTLTCPSource) GetPPM() int32 {
+	return s.ppm
+}
+
+// endregion
+
+func (s *RTLTCPSource) readLoop(conn net.Conn, doneC chan struct{}) {
+	defer close(doneC)
+	var buff = make([]byte, rtlTcpBlockSize*2)
+	var timestamp = uint64(0)
+	for {
+		_, err := io.ReadFull(conn, buff)
+		if err != nil {
+			s.Lock()
+			var closed = s.conn == nil
+			s.running = false
+			s.Unlock()
+			if !closed {
+				log.Printf("rtl_tcp connection to %s lost: %s\n", s.address, err)
+			}
+			return
+		}
+
+		s.Lock()
+		var running = s.running
+		s.Unlock()
+
+		if running && s.cb != nil {
+			s.cb(uint8ToComplex(buff), 0, timestamp)
+		}
+		timestamp += rtlTcpBlockSize
+	}
+}
+
+func boolToUint32(v bool) uint32 {
+	if v {
+		return 1
+	}
+	return 0
+}
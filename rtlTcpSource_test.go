@@ -0,0 +1,167 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeRTLTCPServer accepts one client, sends the dongle info and hands the connection to the test
+func fakeRTLTCPServer(t *testing.T, info RTLTCPDongleInfo) (string, chan net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var connC = make(chan net.Conn, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			close(connC)
+			return
+		}
+		conn.Write(info.Encode())
+		connC <- conn
+	}()
+	return l.Addr().String(), connC
+}
+
+func expectRTLTCPCommand(t *testing.T, conn net.Conn, command uint8, param uint32) {
+	t.Helper()
+	var buff = make([]byte, rtlTcpCommandSize)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err := io.ReadFull(conn, buff)
+	if err != nil {
+		t.Fatalf("waiting for command 0x%02x: %s", command, err)
+	}
+	c, p := DecodeRTLTCPCommand(buff)
+	if c != command || p != param {
+		t.Fatalf("got command 0x%02x %d, expected 0x%02x %d", c, p, command, param)
+	}
+}
+
+func TestRTLTCPSourceCommands(t *testing.T) {
+	address, connC := fakeRTLTCPServer(t, RTLTCPDongleInfo{TunerType: rtlTunerR820T, GainCount: 29})
+
+	var src = MakeRTLTCPSource(address)
+	err := src.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	var conn = <-connC
+	defer conn.Close()
+
+	if src.GetDongleInfo().TunerName() != "R820T" || src.GetDongleInfo().GainCount != 29 {
+		t.Fatalf("unexpected dongle info %+v", src.GetDongleInfo())
+	}
+
+	// Commands sent on connection, with the default parameters
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetSampleRate, 2048000)
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetFrequency, 96900000)
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetFreqCorrection, 0)
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetAGCMode, 0)
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetGainMode, 1)
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetGainByIndex, 14)
+
+	if err := src.SetCenterFrequency(145.5e6); err != nil {
+		t.Fatal(err)
+	}
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetFrequency, 145500000)
+
+	if err := src.SetSampleRate(2.4e6); err != nil {
+		t.Fatal(err)
+	}
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetSampleRate, 2400000)
+
+	if err := src.SetSampleRate(500e3); err == nil {
+		t.Fatal("500 kHz is not a valid rtl-sdr sample rate")
+	}
+
+	if err := src.SetGain(1); err != nil {
+		t.Fatal(err)
+	}
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetGainByIndex, 28)
+
+	if err := src.SetPPM(-3); err != nil {
+		t.Fatal(err)
+	}
+	var ppm = int32(-3)
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetFreqCorrection, uint32(ppm))
+
+	if err := src.SetAGC(true); err != nil {
+		t.Fatal(err)
+	}
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetAGCMode, 1)
+
+	if err := src.SetAutoGain(true); err != nil {
+		t.Fatal(err)
+	}
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetGainMode, 0)
+
+	if err := src.SetAutoGain(false); err != nil {
+		t.Fatal(err)
+	}
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetGainMode, 1)
+	expectRTLTCPCommand(t, conn, rtlTcpCmdSetGainByIndex, 28)
+}
+
+func TestRTLTCPSourceSamples(t *testing.T) {
+	address, connC := fakeRTLTCPServer(t, RTLTCPDongleInfo{TunerType: rtlTunerE4000, GainCount: 14})
+
+	var src = MakeRTLTCPSource(address)
+	var samplesC = make(chan []complex64, 4)
+	src.SetCallback(func(data []complex64, channel int, timestamp uint64) {
+		samplesC <- data
+	})
+	err := src.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	var conn = <-connC
+	defer conn.Close()
+
+	err = src.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One block of a ramp, I going up and Q going down
+	var block = make([]byte, rtlTcpBlockSize*2)
+	for i := 0; i < rtlTcpBlockSize; i++ {
+		block[i*2] = byte(i)
+		block[i*2+1] = byte(255 - i)
+	}
+	_, err = conn.Write(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var samples []complex64
+	select {
+	case samples = <-samplesC:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no samples received")
+	}
+
+	if len(samples) != rtlTcpBlockSize {
+		t.Fatalf("got %d samples, expected %d", len(samples), rtlTcpBlockSize)
+	}
+
+	var expected = map[int]complex64{
+		0:   complex(-1, 1),
+		255: complex(1, -1),
+		127: complex(-0.5/127.5, 0.5/127.5),
+		128: complex(0.5/127.5, -0.5/127.5),
+		256: complex(-1, 1),
+	}
+	for i, e := range expected {
+		if samples[i] != e {
+			t.Errorf("sample %d is %v, expected %v", i, samples[i], e)
+		}
+	}
+}
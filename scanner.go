@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	scanSourceRange = iota
+	scanSourceBookmarks
+)
+
+var scanSourceNames = []string{"Range", "Bookmarks"}
+
+type scanState int
+
+const (
+	scanStateMeasuring scanState = iota
+	scanStateActive
+	scanStateHang
+)
+
+// scanMaxChannels limits the size of a range scan
+const scanMaxChannels = 100000
+
+// scanChannel is a frequency to listen to, with the bookmark it comes from if any
+type scanChannel struct {
+	Frequency float64
+	Bookmark  *Bookmark
+}
+
+var scanning = false
+var scanSource = int32(scanSourceRange)
+var scanStart = 144e6
+var scanStop = 146e6
+var scanStep = 12.5e3
+
+// scanTag limits a bookmark scan to the bookmarks with this tag
+var scanTag = ""
+
+// scanSquelch is the channel power in dBFS over which the scanner stops
+var scanSquelch = float32(-60)
+
+// scanDwell is how long each channel is measured, scanHang how long the scanner stays after the signal is gone
+var scanDwell = 100 * time.Millisecond
+var scanHang = 2 * time.Second
+
+// scanPriorityInterval is how often the priority channels are checked while scanning or stopped on another channel
+var scanPriorityInterval = 2 * time.Second
+
+// Lockouts are skipped, priority channels are checked every scanPriorityInterval. Both are keyed by frequency in Hz.
+var scanLockouts = make(map[int64]bool)
+var scanPriority = make(map[int64]bool)
+
+var scanIndex = 0
+var scanCurrent scanChannel
+var scanCurrentState = scanStateMeasuring
+var scanStateSince = time.Now()
+var scanPowerSum = 0.0
+var scanPowerCount = 0
+var scanLastPower = float32(math.Inf(-1))
+
+// scanPriorityQueue are the priority channels left to check, then the scanner goes back to scanResume
+var scanPriorityQueue []scanChannel
+var scanResume *scanChannel
+var lastPriorityCheck = time.Now()
+
+func IsScanning() bool {
+	return scanning
+}
+
+func StartScan() {
+	if scanChannelCount() == 0 {
+		log.Println("Nothing to scan")
+		return
+	}
+	scanning = true
+	scanIndex = -1
+	scanPriorityQueue = nil
+	scanResume = nil
+	lastPriorityCheck = time.Now()
+	setScanState(scanStateMeasuring)
+	scanNext()
+}
+
+func StopScan() {
+	scanning = false
+}
+
+// GetScanStatus describes what the scanner is doing, for the UI
+func GetScanStatus() string {
+	if !scanning {
+		return "Stopped"
+	}
+	var name = formatAxisFrequency(scanCurrent.Frequency, 1)
+	if scanCurrent.Bookmark != nil {
+		name = fmt.Sprintf("%s (%s)", scanCurrent.Bookmark.Name, name)
+	}
+	switch scanCurrentState {
+	case scanStateActive:
+		return fmt.Sprintf("Active: %s", name)
+	case scanStateHang:
+		return fmt.Sprintf("Hang: %s", name)
+	}
+	return fmt.Sprintf("Scanning: %s", name)
+}
+
+// GetScanPower returns the last channel power measured by the scanner, in dBFS
+func GetScanPower() float32 {
+	return scanLastPower
+}
+
+func IsScanStopped() bool {
+	return scanning && scanCurrentState != scanStateMeasuring
+}
+
+func channelKey(frequency float64) int64 {
+	return int64(math.Round(frequency))
+}
+
+// LockoutChannel skips frequency from now on, moving on if the scanner is on it
+func LockoutChannel(frequency float64) {
+	scanLockouts[channelKey(frequency)] = true
+	if scanning && channelKey(scanCurrent.Frequency) == channelKey(frequency) {
+		scanNext()
+	}
+}
+
+func ClearLockouts() {
+	scanLockouts = make(map[int64]bool)
+}
+
+func IsPriorityChannel(frequency float64) bool {
+	return scanPriority[channelKey(frequency)]
+}
+
+func TogglePriorityChannel(frequency float64) {
+	var key = channelKey(frequency)
+	if scanPriority[key] {
+		delete(scanPriority, key)
+	} else {
+		scanPriority[key] = true
+	}
+}
+
+// SkipChannel resumes scanning from a channel the scanner stopped on
+func SkipChannel() {
+	if scanning {
+		scanNext()
+	}
+}
+
+func scanBookmarks() []Bookmark {
+	var list = make([]Bookmark, 0)
+	for _, b := range bookmarks {
+		if b.HasTag(scanTag) {
+			list = append(list, b)
+		}
+	}
+	return list
+}
+
+func scanChannelCount() int {
+	if scanSource == scanSourceBookmarks {
+		return len(scanBookmarks())
+	}
+	if scanStep <= 0 || scanStop < scanStart {
+		return 0
+	}
+	return int(math.Min(scanMaxChannels, math.Floor((scanStop-scanStart)/scanStep+1e-9)+1))
+}
+
+func scanChannelAt(index int) scanChannel {
+	if scanSource == scanSourceBookmarks {
+		var list = scanBookmarks()
+		if index < len(list) {
+			return scanChannel{Frequency: list[index].Frequency, Bookmark: &list[index]}
+		}
+		return scanChannel{}
+	}
+	return scanChannel{Frequency: scanStart + float64(index)*scanStep}
+}
+
+// scanPriorityChannels returns the priority channels of the scan list, except the current one
+func scanPriorityChannels() []scanChannel {
+	var channels = make([]scanChannel, 0)
+	var add = func(ch scanChannel) {
+		var key = channelKey(ch.Frequency)
+		if scanPriority[key] && !scanLockouts[key] && key != channelKey(scanCurrent.Frequency) && scanReachable(ch) {
+			channels = append(channels, ch)
+		}
+	}
+
+	if scanSource == scanSourceBookmarks {
+		var list = scanBookmarks()
+		for i := range list {
+			add(scanChannel{Frequency: list[i].Frequency, Bookmark: &list[i]})
+		}
+		return channels
+	}
+
+	// Range scans can have many channels, only the priority ones are looked at
+	for key := range scanPriority {
+		var f = float64(key)
+		if f >= scanStart && f <= scanStop {
+			add(scanChannel{Frequency: f})
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Frequency < channels[j].Frequency
+	})
+	return channels
+}
+
+// scanReachable tells if ch can be received. Recordings and the generator cannot retune, only their captured span can be scanned.
+func scanReachable(ch scanChannel) bool {
+	if canRetune() {
+		return true
+	}
+	var p = GetChannelParams(demodMode, demodBandwidth)
+	if ch.Bookmark != nil {
+		var mode = demodModeByName(ch.Bookmark.Mode)
+		var bandwidth = ch.Bookmark.Bandwidth
+		if bandwidth <= 0 {
+			bandwidth = demodModes[mode].defaultBandwidth
+		}
+		p = GetChannelParams(mode, ClampBandwidth(mode, bandwidth))
+	}
+	var halfSpan = sampleRate / 2 * vfoUsableSpan
+	var offset = ch.Frequency - centerFreq
+	return offset+p.LowCut >= -halfSpan && offset+p.HighCut <= halfSpan
+}
+
+func scanTune(ch scanChannel) {
+	scanCurrent = ch
+	if ch.Bookmark != nil {
+		TuneBookmark(*ch.Bookmark)
+	} else {
+		SetVFOFrequency(ch.Frequency)
+	}
+	setScanState(scanStateMeasuring)
+}
+
+func setScanState(state scanState) {
+	scanCurrentState = state
+	scanStateSince = time.Now()
+	scanPowerSum = 0
+	scanPowerCount = 0
+}
+
+// scanNext tunes to the next channel, checking the priority channels when they are due
+func scanNext() {
+	if len(scanPriorityQueue) == 0 && time.Since(lastPriorityCheck) >= scanPriorityInterval {
+		lastPriorityCheck = time.Now()
+		scanPriorityQueue = scanPriorityChannels()
+		if len(scanPriorityQueue) > 0 && scanCurrentState != scanStateMeasuring && scanResume == nil {
+			// Come back to the channel the scanner was stopped on
+			var current = scanCurrent
+			scanResume = &current
+		}
+	}
+	if len(scanPriorityQueue) > 0 {
+		var ch = scanPriorityQueue[0]
+		scanPriorityQueue = scanPriorityQueue[1:]
+		scanTune(ch)
+		return
+	}
+	if scanResume != nil {
+		var ch = *scanResume
+		scanResume = nil
+		scanTune(ch)
+		return
+	}
+
+	var count = scanChannelCount()
+	for i := 0; i < count; i++ {
+		scanIndex = (scanIndex + 1) % count
+		var ch = scanChannelAt(scanIndex)
+		if !scanLockouts[channelKey(ch.Frequency)] && scanReachable(ch) {
+			scanTune(ch)
+			return
+		}
+	}
+
+	log.Println("All channels are locked out or outside of the captured span, stopping the scanner")
+	StopScan()
+}
+
+// updateScanner runs the scanner with the instantaneous measurement of the tuned channel. Called from Gen with drawLock held,
+// only with samples captured after the last retune.
+func updateScanner(m ChannelMeasurement) {
+	if !scanning || !m.Valid {
+		return
+	}
+	if scanCurrentState == scanStateMeasuring && scanPowerCount == 0 {
+		// The dwell starts with the first measurement of the channel
+		scanStateSince = time.Now()
+	}
+	var since = time.Since(scanStateSince)
+	scanLastPower = float32(m.ChannelPower)
+	var open = m.ChannelPower >= float64(scanSquelch)
+
+	switch scanCurrentState {
+	case scanStateMeasuring:
+		scanPowerSum += math.Pow(10, m.ChannelPower/10)
+		scanPowerCount++
+		if since < scanDwell {
+			return
+		}
+		var power = 10 * math.Log10(scanPowerSum/float64(scanPowerCount))
+		if power >= float64(scanSquelch) {
+			log.Printf("Scanner stopped on %s, %.1f dBFS\n", formatAxisFrequency(scanCurrent.Frequency, 1), power)
+			setScanState(scanStateActive)
+			return
+		}
+		scanNext()
+	case scanStateActive:
+		if !open {
+			setScanState(scanStateHang)
+			return
+		}
+		if !IsPriorityChannel(scanCurrent.Frequency) && time.Since(lastPriorityCheck) >= scanPriorityInterval && len(scanPriorityChannels()) > 0 {
+			scanNext()
+		}
+	case scanStateHang:
+		if open {
+			setScanState(scanStateActive)
+		} else if since >= scanHang {
+			scanNext()
+		}
+	}
+}
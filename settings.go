@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// settingsAutoSaveInterval is how often the settings are compared to the saved ones
+const settingsAutoSaveInterval = time.Second
+
+// Profile is a named set of tuning parameters for a kind of signal
+type Profile struct {
+	Name       string  `json:"name"`
+	Frequency  float64 `json:"frequency"`
+	SampleRate float64 `json:"sampleRate"`
+	Gain       float64 `json:"gain"`
+	Mode       string  `json:"mode"`
+	Bandwidth  float64 `json:"bandwidth"`
+	TuningStep float64 `json:"tuningStep"`
+}
+
+// Settings is everything kept between runs
+type Settings struct {
+	Source        string  `json:"source"`
+	DeviceIndex   int     `json:"deviceIndex"`
+	DeviceSerial  string  `json:"deviceSerial"`
+	FilePath      string  `json:"filePath"`
+	FileFormat    int32   `json:"fileFormat"`
+	RTLTCPAddress string  `json:"rtlTcpAddress"`
+	LPF           float64 `json:"lpf"`
+	AudioDevice   string  `json:"audioDevice"`
+
+	CenterFrequency float64 `json:"centerFrequency"`
+	VFOFrequency    float64 `json:"vfoFrequency"`
+	SampleRate      float64 `json:"sampleRate"`
+	Gain            float64 `json:"gain"`
+	Antenna         int32   `json:"antenna"`
+	OffsetTuning    bool    `json:"offsetTuning"`
+	TuningStep      float64 `json:"tuningStep"`
+
+	Mode       string  `json:"mode"`
+	Bandwidth  float64 `json:"bandwidth"`
+	Deemphasis float64 `json:"deemphasis"`
+	ForceMono  bool    `json:"forceMono"`
+
+	FFTSize           int32    `json:"fftSize"`
+	Averaging         float32  `json:"averaging"`
+	Window            string   `json:"window"`
+	KaiserBeta        float64  `json:"kaiserBeta"`
+	RefLevel          float32  `json:"refLevel"`
+	DBPerDiv          float32  `json:"dbPerDiv"`
+	WaterfallMin      float32  `json:"waterfallMin"`
+	WaterfallMax      float32  `json:"waterfallMax"`
+	WaterfallLineRate float32  `json:"waterfallLineRate"`
+	Palette           string   `json:"palette"`
+	PaletteFiles      []string `json:"paletteFiles"`
+	ShowBandPlan      bool     `json:"showBandPlan"`
+	BandPlanRegion    int      `json:"bandPlanRegion"`
+
+	RecordingDir string `json:"recordingDir"`
+
+	ScanSource   int32     `json:"scanSource"`
+	ScanStart    float64   `json:"scanStart"`
+	ScanStop     float64   `json:"scanStop"`
+	ScanStep     float64   `json:"scanStep"`
+	ScanTag      string    `json:"scanTag"`
+	ScanSquelch  float32   `json:"scanSquelch"`
+	ScanDwell    int64     `json:"scanDwellMs"`
+	ScanHang     int64     `json:"scanHangMs"`
+	ScanLockouts []float64 `json:"scanLockouts"`
+	ScanPriority []float64 `json:"scanPriority"`
+
+	Profiles  []Profile  `json:"profiles"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+var profiles = defaultProfiles()
+var selectedProfile = int32(0)
+
+// settings are the ones loaded at startup, lastSavedSettings is what is on disk
+var settings = defaultSettings()
+var lastSavedSettings []byte
+var lastSettingsCheck = time.Now()
+
+// fileSettings are the settings before the command line flags, settingsFlags the flags that changed them.
+// The flags are for one run, so the file values of those settings are the ones saved.
+var fileSettings Settings
+var settingsFlags []string
+
+// defaultSettings has the source parameters used when there is no settings file
+func defaultSettings() Settings {
+	return Settings{
+		Source:          "lime",
+		LPF:             10e6,
+		CenterFrequency: 96.9e6,
+		SampleRate:      2e6,
+		Gain:            0.4,
+	}
+}
+
+func defaultProfiles() []Profile {
+	return []Profile{
+		{Name: "FM broadcast", Frequency: 96.9e6, SampleRate: 2e6, Gain: 0.4, Mode: "WFM", Bandwidth: 192e3, TuningStep: 100e3},
+		{Name: "Airband", Frequency: 121.5e6, SampleRate: 2e6, Gain: 0.6, Mode: "AM", Bandwidth: 8e3, TuningStep: 25e3 / 3},
+		{Name: "2 m ham", Frequency: 145.5e6, SampleRate: 2e6, Gain: 0.5, Mode: "NFM", Bandwidth: 12.5e3, TuningStep: 12.5e3},
+	}
+}
+
+// settingsPath is settings.json in the segdsp folder of the user config directory
+func settingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "segdsp", "settings.json"), nil
+}
+
+// LoadSettings reads the settings file, the defaults are kept for anything missing
+func LoadSettings() error {
+	filename, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var s = currentSettings()
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+
+	if _, err := os.Stat(s.FilePath); s.Source == "file" && err != nil {
+		log.Printf("File %s not found, opening LimeSDR\n", s.FilePath)
+		s.Source = "lime"
+	}
+
+	applySettings(s)
+	lastSavedSettings = data
+	return nil
+}
+
+func SaveSettings() error {
+	filename, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(savedSettings(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(filename+".tmp", filename)
+	if err != nil {
+		return err
+	}
+
+	lastSavedSettings = data
+	return nil
+}
+
+// autoSaveSettings saves the settings when something changed. Called on every frame, with drawLock held.
+func autoSaveSettings() {
+	if time.Since(lastSettingsCheck) < settingsAutoSaveInterval || !dspLoaded.Get() {
+		return
+	}
+	lastSettingsCheck = time.Now()
+
+	data, err := json.MarshalIndent(savedSettings(), "", "  ")
+	if err != nil || bytes.Equal(data, lastSavedSettings) {
+		return
+	}
+	err = SaveSettings()
+	if err != nil {
+		log.Printf("Error saving settings: %s\n", err)
+	}
+}
+
+// savedSettings are the current settings, except for the ones given on the command line that keep their file values
+func savedSettings() Settings {
+	var s = currentSettings()
+	for _, name := range settingsFlags {
+		settingsFlagFields[name](&s, fileSettings)
+	}
+	return s
+}
+
+func currentSettings() Settings {
+	var s = Settings{
+		Source:        sourceKind(source),
+		DeviceIndex:   settings.DeviceIndex,
+		DeviceSerial:  settings.DeviceSerial,
+		FilePath:      fileSourcePath,
+		FileFormat:    fileSourceFormat,
+		RTLTCPAddress: rtlTcpAddress,
+		LPF:           settings.LPF,
+		AudioDevice:   settings.AudioDevice,
+
+		CenterFrequency: centerFreq,
+		VFOFrequency:    vfoFrequency,
+		SampleRate:      sampleRate,
+		Gain:            gain,
+		Antenna:         antenna,
+		OffsetTuning:    offsetTuning,
+		TuningStep:      tuningSteps[selectedTuningStep],
+
+		Mode:       demodMode.String(),
+		Bandwidth:  demodBandwidth,
+		Deemphasis: deemphasisTau,
+		ForceMono:  forceMono,
+
+		FFTSize:           fftSize,
+		Averaging:         acc,
+		Window:            fftWindowType.String(),
+		KaiserBeta:        kaiserBeta,
+		RefLevel:          fftOffset,
+		DBPerDiv:          fftDBPerDiv,
+		WaterfallMin:      waterfallMin,
+		WaterfallMax:      waterfallMax,
+		WaterfallLineRate: waterfallLineRate,
+		Palette:           palettes[selectedPalette].Name,
+		ShowBandPlan:      showBandPlan,
+		BandPlanRegion:    bandPlanRegion,
+
+		RecordingDir: recordingDir,
+
+		ScanSource:   scanSource,
+		ScanStart:    scanStart,
+		ScanStop:     scanStop,
+		ScanStep:     scanStep,
+		ScanTag:      scanTag,
+		ScanSquelch:  scanSquelch,
+		ScanDwell:    int64(scanDwell / time.Millisecond),
+		ScanHang:     int64(scanHang / time.Millisecond),
+		ScanLockouts: channelList(scanLockouts),
+		ScanPriority: channelList(scanPriority),
+
+		Profiles:  profiles,
+		Bookmarks: bookmarks,
+	}
+
+	for _, p := range palettes {
+		if p.File != "" {
+			s.PaletteFiles = append(s.PaletteFiles, p.File)
+		}
+	}
+
+	// Keep the source parameters the settings were loaded with while the source is not open yet
+	if source == nil {
+		s.Source = settings.Source
+		s.CenterFrequency = settings.CenterFrequency
+		s.VFOFrequency = settings.VFOFrequency
+		s.SampleRate = settings.SampleRate
+		s.Gain = settings.Gain
+		s.Antenna = settings.Antenna
+	}
+
+	return s
+}
+
+// applySettings loads s into the application. It runs before the source is opened.
+func applySettings(s Settings) {
+	settings = s
+
+	fileSourcePath = s.FilePath
+	fileSourceFormat = s.FileFormat
+	rtlTcpAddress = s.RTLTCPAddress
+
+	centerFreq = s.CenterFrequency
+	sampleRate = s.SampleRate
+	gain = s.Gain
+	antenna = s.Antenna
+	offsetTuning = s.OffsetTuning
+	selectedTuningStep = tuningStepIndex(s.TuningStep)
+
+	demodMode = demodModeByName(s.Mode)
+	demodBandwidth = ClampBandwidth(demodMode, s.Bandwidth)
+	deemphasisTau = s.Deemphasis
+	forceMono = s.ForceMono
+
+	if s.FFTSize >= 128 && s.FFTSize <= 16384 {
+		fftSize = s.FFTSize
+		selectedFFTSize = int32(math.Log2(float64(s.FFTSize))) - 7
+	}
+	if s.Averaging >= 1 {
+		acc = s.Averaging
+	}
+	for i, name := range fftWindowNames {
+		if name == s.Window {
+			fftWindowType = FFTWindowType(i)
+		}
+	}
+	kaiserBeta = s.KaiserBeta
+	fftOffset = s.RefLevel
+	SetDBPerDiv(s.DBPerDiv)
+	waterfallMin = s.WaterfallMin
+	waterfallMax = s.WaterfallMax
+	if s.WaterfallLineRate >= 1 {
+		waterfallLineRate = s.WaterfallLineRate
+	}
+
+	for _, filename := range s.PaletteFiles {
+		if paletteLoaded(filename) {
+			continue
+		}
+		err := LoadPaletteFile(filename)
+		if err != nil {
+			log.Printf("Error loading palette %s: %s\n", filename, err)
+		}
+	}
+	SetPalette(0)
+	for i, p := range palettes {
+		if p.Name == s.Palette {
+			SetPalette(int32(i))
+		}
+	}
+
+	showBandPlan = s.ShowBandPlan
+	if s.BandPlanRegion >= 1 && s.BandPlanRegion <= 3 {
+		bandPlanRegion = s.BandPlanRegion
+	}
+
+	recordingDir = s.RecordingDir
+
+	scanSource = s.ScanSource
+	scanStart = s.ScanStart
+	scanStop = s.ScanStop
+	scanStep = s.ScanStep
+	scanTag = s.ScanTag
+	scanSquelch = s.ScanSquelch
+	scanDwell = time.Duration(s.ScanDwell) * time.Millisecond
+	scanHang = time.Duration(s.ScanHang) * time.Millisecond
+	scanLockouts = channelSet(s.ScanLockouts)
+	scanPriority = channelSet(s.ScanPriority)
+
+	// An empty list means every profile was deleted, only a missing one gets the defaults
+	if s.Profiles != nil {
+		profiles = s.Profiles
+	}
+	if s.Bookmarks != nil {
+		bookmarks = s.Bookmarks
+		sortBookmarks()
+	}
+
+	sourceFactory = settingsSourceFactory
+}
+
+// settingsSourceFactory opens the source of the settings, tuned like it was on the last run
+func settingsSourceFactory() SampleSource {
+	var src SampleSource
+	switch settings.Source {
+	case "file":
+		var fs = MakeFileSource(settings.FilePath, IQFormat(settings.FileFormat), settings.SampleRate, settings.CenterFrequency)
+		fs.SetLoop(fileSourceLoop)
+		return fs
+	case "rtltcp":
+		src = MakeRTLTCPSource(settings.RTLTCPAddress)
+	case "generator":
+		return MakeGeneratorSource(settings.SampleRate, settings.CenterFrequency)
+	default:
+		src = makeSettingsLimeSDRSource()
+	}
+
+	_ = src.SetCenterFrequency(settings.CenterFrequency)
+	_ = src.SetSampleRate(settings.SampleRate)
+	_ = src.SetGain(settings.Gain)
+	_ = src.SetAntenna(int(settings.Antenna))
+	return src
+}
+
+func makeSettingsLimeSDRSource() *LimeSDRSource {
+	var ls = MakeLimeSDRSource(settings.DeviceIndex, 0)
+	if settings.DeviceSerial != "" {
+		ls = MakeLimeSDRSourceBySerial(settings.DeviceSerial, 0)
+	}
+	if settings.LPF > 0 {
+		ls.SetLPF(settings.LPF)
+	}
+	return ls
+}
+
+// restoreTuning tunes the VFO back to where it was on the last run and selects the antenna asked by name, once the first source is attached
+func restoreTuning() {
+	if settings.VFOFrequency != 0 {
+		SetVFOFrequency(settings.VFOFrequency)
+		settings.VFOFrequency = 0
+	}
+	if startupAntenna != "" {
+		for i, name := range antennaList {
+			if strings.EqualFold(name, startupAntenna) {
+				SetAntenna(int32(i))
+			}
+		}
+		if !strings.EqualFold(antennaList[antenna], startupAntenna) {
+			log.Printf("Antenna %s not found\n", startupAntenna)
+		}
+		startupAntenna = ""
+	}
+}
+
+// channelList turns a set of channels into a sorted list of frequencies, so the settings file does not change on every save
+func channelList(set map[int64]bool) []float64 {
+	var list = make([]float64, 0, len(set))
+	for key := range set {
+		list = append(list, float64(key))
+	}
+	sort.Float64s(list)
+	return list
+}
+
+func channelSet(list []float64) map[int64]bool {
+	var set = make(map[int64]bool)
+	for _, f := range list {
+		set[channelKey(f)] = true
+	}
+	return set
+}
+
+func paletteLoaded(filename string) bool {
+	for _, p := range palettes {
+		if p.File == filename {
+			return true
+		}
+	}
+	return false
+}
+
+func sourceKind(src SampleSource) string {
+	switch src.(type) {
+	case *FileSource:
+		return "file"
+	case *RTLTCPSource:
+		return "rtltcp"
+	case *GeneratorSource:
+		return "generator"
+	}
+	return "lime"
+}
+
+func demodModeByName(name string) DemodMode {
+	for i, n := range demodModeNames {
+		if n == name {
+			return DemodMode(i)
+		}
+	}
+	return ModeWFM
+}
+
+// tuningStepIndex returns the tuning step closest to step
+func tuningStepIndex(step float64) int32 {
+	var best = 0
+	for i, s := range tuningSteps {
+		if math.Abs(s-step) < math.Abs(tuningSteps[best]-step) {
+			best = i
+		}
+	}
+	return int32(best)
+}
+
+// region Profiles
+
+func CurrentProfile(name string) Profile {
+	return Profile{
+		Name:       name,
+		Frequency:  vfoFrequency,
+		SampleRate: sampleRate,
+		Gain:       gain,
+		Mode:       demodMode.String(),
+		Bandwidth:  demodBandwidth,
+		TuningStep: tuningSteps[selectedTuningStep],
+	}
+}
+
+// SaveProfile stores the current tuning as the profile called name, replacing it if it exists
+func SaveProfile(name string) {
+	var p = CurrentProfile(name)
+	for i := range profiles {
+		if profiles[i].Name == name {
+			profiles[i] = p
+			selectedProfile = int32(i)
+			return
+		}
+	}
+	profiles = append(profiles, p)
+	selectedProfile = int32(len(profiles) - 1)
+}
+
+func DeleteProfile(index int32) {
+	if index < 0 || int(index) >= len(profiles) {
+		return
+	}
+	profiles = append(profiles[:index:index], profiles[index+1:]...)
+	if selectedProfile >= int32(len(profiles)) {
+		selectedProfile = int32(len(profiles)) - 1
+	}
+	if selectedProfile < 0 {
+		selectedProfile = 0
+	}
+}
+
+func ApplyProfile(p Profile) {
+	if p.SampleRate > 0 && p.SampleRate != sampleRate {
+		err := SetSampleRate(p.SampleRate)
+		if err != nil {
+			log.Printf("Error setting sample rate: %s\n", err)
+		}
+	}
+	SetGain(p.Gain)
+	SetDemodMode(demodModeByName(p.Mode))
+	SetDemodBandwidth(p.Bandwidth)
+	selectedTuningStep = tuningStepIndex(p.TuningStep)
+	SetVFOFrequency(p.Frequency)
+}
+
+// endregion
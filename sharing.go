@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+var rtlTcpServer *RTLTCPServer
+var rtlTcpServerMtx = sync.Mutex{}
+var rtlTcpServerAddress = "0.0.0.0:1234"
+
+func IsSharing() bool {
+	rtlTcpServerMtx.Lock()
+	defer rtlTcpServerMtx.Unlock()
+	return rtlTcpServer != nil
+}
+
+// StartSharing exposes the current source as a rtl_tcp server
+func StartSharing() error {
+	rtlTcpServerMtx.Lock()
+	defer rtlTcpServerMtx.Unlock()
+	if rtlTcpServer != nil {
+		return nil
+	}
+
+	var server = MakeRTLTCPServer(rtlTcpServerAddress, onRTLTCPServerCommand)
+	err := server.Start()
+	if err != nil {
+		return err
+	}
+
+	rtlTcpServer = server
+	return nil
+}
+
+func StopSharing() {
+	rtlTcpServerMtx.Lock()
+	defer rtlTcpServerMtx.Unlock()
+	if rtlTcpServer != nil {
+		rtlTcpServer.Stop()
+		rtlTcpServer = nil
+		log.Println("rtl_tcp server stopped")
+	}
+}
+
+func SharingClientCount() int {
+	rtlTcpServerMtx.Lock()
+	defer rtlTcpServerMtx.Unlock()
+	if rtlTcpServer == nil {
+		return 0
+	}
+	return rtlTcpServer.ClientCount()
+}
+
+func shareSamples(data []complex64) {
+	rtlTcpServerMtx.Lock()
+	defer rtlTcpServerMtx.Unlock()
+	if rtlTcpServer != nil {
+		rtlTcpServer.Feed(data)
+	}
+}
+
+// onRTLTCPServerCommand translates the commands of rtl_tcp clients into the current source settings.
+// Runs on the client goroutine, so it takes drawLock like the UI does before changing the source.
+func onRTLTCPServerCommand(command uint8, param uint32) {
+	drawLock.Lock()
+	defer drawLock.Unlock()
+
+	switch command {
+	case rtlTcpCmdSetFrequency:
+		SetCenterFrequency(float64(param))
+	case rtlTcpCmdSetSampleRate:
+		err := SetSampleRate(float64(param))
+		if err != nil {
+			log.Printf("rtl_tcp client requested invalid sample rate %d: %s\n", param, err)
+		}
+	case rtlTcpCmdSetGain:
+		SetGain(rtlNormalizedGain(int32(param), rtlTunerR820T))
+	case rtlTcpCmdSetGainByIndex:
+		var maxIndex = len(rtlTunerGains[rtlTunerR820T]) - 1
+		var index = int(param)
+		if param > uint32(maxIndex) {
+			index = maxIndex
+		}
+		SetGain(float64(index) / float64(maxIndex))
+	case rtlTcpCmdSetFreqCorrection:
+		if rs, ok := source.(*RTLTCPSource); ok {
+			rs.SetPPM(int32(param))
+		}
+	case rtlTcpCmdSetAGCMode:
+		if rs, ok := source.(*RTLTCPSource); ok {
+			rs.SetAGC(param != 0)
+		}
+	case rtlTcpCmdSetGainMode:
+		if rs, ok := source.(*RTLTCPSource); ok {
+			rs.SetAutoGain(param == 0)
+		}
+	default:
+		log.Printf("rtl_tcp command 0x%02x (%d) not supported by %s\n", command, param, source.GetName())
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sigmfVersion = "1.0.0"
+const sigmfDateFormat = "2006-01-02T15:04:05.000Z"
+
+// region SigMF Metadata
+
+type SigMFExtension struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Optional bool   `json:"optional"`
+}
+
+type SigMFGlobal struct {
+	Datatype    string           `json:"core:datatype"`
+	SampleRate  float64          `json:"core:sample_rate,omitempty"`
+	Version     string           `json:"core:version"`
+	Description string           `json:"core:description,omitempty"`
+	Recorder    string           `json:"core:recorder,omitempty"`
+	HW          string           `json:"core:hw,omitempty"`
+	Extensions  []SigMFExtension `json:"core:extensions,omitempty"`
+}
+
+type SigMFCapture struct {
+	SampleStart uint64  `json:"core:sample_start"`
+	Frequency   float64 `json:"core:frequency,omitempty"`
+	Datetime    string  `json:"core:datetime,omitempty"`
+	Gain        float64 `json:"segdsp:gain"`
+	Antenna     string  `json:"segdsp:antenna,omitempty"`
+}
+
+type SigMFAnnotation struct {
+	SampleStart   uint64  `json:"core:sample_start"`
+	SampleCount   uint64  `json:"core:sample_count,omitempty"`
+	FreqLowerEdge float64 `json:"core:freq_lower_edge,omitempty"`
+	FreqUpperEdge float64 `json:"core:freq_upper_edge,omitempty"`
+	Label         string  `json:"core:label,omitempty"`
+	Comment       string  `json:"core:comment,omitempty"`
+}
+
+type SigMFMeta struct {
+	Global      SigMFGlobal       `json:"global"`
+	Captures    []SigMFCapture    `json:"captures"`
+	Annotations []SigMFAnnotation `json:"annotations"`
+}
+
+// SigMFBasePath strips the SigMF extension from a .sigmf-meta or .sigmf-data filename
+func SigMFBasePath(filename string) string {
+	filename = strings.TrimSuffix(filename, ".sigmf-meta")
+	filename = strings.TrimSuffix(filename, ".sigmf-data")
+	return filename
+}
+
+func ReadSigMFMeta(filename string) (*SigMFMeta, error) {
+	data, err := ioutil.ReadFile(SigMFBasePath(filename) + ".sigmf-meta")
+	if err != nil {
+		return nil, err
+	}
+
+	var meta SigMFMeta
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return &meta, nil
+}
+
+// IQFormat returns the sample format of the dataset, or an error if it is not supported
+func (m *SigMFMeta) IQFormat() (IQFormat, error) {
+	switch m.Global.Datatype {
+	case "cf32_le", "cf32":
+		return IQFormatComplex64, nil
+	case "ci16_le", "ci16":
+		return IQFormatInt16, nil
+	case "cu8_le", "cu8":
+		return IQFormatUint8, nil
+	}
+	return IQFormatAuto, fmt.Errorf("unsupported SigMF datatype %q", m.Global.Datatype)
+}
+
+// CaptureAt returns the capture segment that contains the sample
+func (m *SigMFMeta) CaptureAt(sample uint64) *SigMFCapture {
+	var capture *SigMFCapture
+	for i := range m.Captures {
+		if m.Captures[i].SampleStart <= sample {
+			capture = &m.Captures[i]
+		}
+	}
+	return capture
+}
+
+// AnnotationsAt returns all annotations that overlap the sample
+func (m *SigMFMeta) AnnotationsAt(sample uint64) []SigMFAnnotation {
+	var annotations = make([]SigMFAnnotation, 0)
+	for _, a := range m.Annotations {
+		if a.SampleStart <= sample && (a.SampleCount == 0 || sample < a.SampleStart+a.SampleCount) {
+			annotations = append(annotations, a)
+		}
+	}
+	return annotations
+}
+
+// endregion
+// region SigMF Recorder
+
+type SigMFRecorder struct {
+	sync.Mutex
+
+	basePath string
+	file     *os.File
+	writer   *bufio.Writer
+	meta     SigMFMeta
+	buff     []byte
+
+	samplesWritten uint64
+	startTime      time.Time
+
+	frequency float64
+	gain      float64
+	antenna   string
+}
+
+// StartSigMFRecording creates basePath.sigmf-data and starts recording to it. The metadata is written on Close.
+func StartSigMFRecording(basePath string, sampleRate, frequency, gain float64, antenna, hw string) (*SigMFRecorder, error) {
+	f, err := os.Create(basePath + ".sigmf-data")
+	if err != nil {
+		return nil, err
+	}
+
+	var r = &SigMFRecorder{
+		basePath:  basePath,
+		file:      f,
+		writer:    bufio.NewWriterSize(f, 1024*1024),
+		startTime: time.Now(),
+		frequency: frequency,
+		gain:      gain,
+		antenna:   antenna,
+	}
+
+	r.meta = SigMFMeta{
+		Global: SigMFGlobal{
+			Datatype:    "cf32_le",
+			SampleRate:  sampleRate,
+			Version:     sigmfVersion,
+			Description: "SegDSP Sample Application IQ Recording",
+			Recorder:    "segdsp-sample",
+			HW:          hw,
+			Extensions: []SigMFExtension{
+				{Name: "segdsp", Version: "1.0.0", Optional: true},
+			},
+		},
+		Captures:    make([]SigMFCapture, 0),
+		Annotations: make([]SigMFAnnotation, 0),
+	}
+
+	r.addCapture()
+
+	return r, nil
+}
+
+func (r *SigMFRecorder) GetBasePath() string {
+	return r.basePath
+}
+
+func (r *SigMFRecorder) GetDuration() time.Duration {
+	r.Lock()
+	defer r.Unlock()
+	return time.Duration(float64(r.samplesWritten) / r.meta.Global.SampleRate * float64(time.Second))
+}
+
+// addCapture must be called with the lock held
+func (r *SigMFRecorder) addCapture() {
+	var now = r.startTime.Add(time.Duration(float64(r.samplesWritten) / r.meta.Global.SampleRate * float64(time.Second)))
+	var capture = SigMFCapture{
+		SampleStart: r.samplesWritten,
+		Frequency:   r.frequency,
+		Datetime:    now.UTC().Format(sigmfDateFormat),
+		Gain:        r.gain,
+		Antenna:     r.antenna,
+	}
+	var last = len(r.meta.Captures) - 1
+	if last >= 0 && r.meta.Captures[last].SampleStart == capture.SampleStart {
+		r.meta.Captures[last] = capture
+	} else {
+		r.meta.Captures = append(r.meta.Captures, capture)
+	}
+}
+
+func (r *SigMFRecorder) Write(data []complex64) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.file == nil {
+		return fmt.Errorf("recording already closed")
+	}
+
+	if len(r.buff) < len(data)*8 {
+		r.buff = make([]byte, len(data)*8)
+	}
+
+	for i, v := range data {
+		binary.LittleEndian.PutUint32(r.buff[i*8:], math.Float32bits(real(v)))
+		binary.LittleEndian.PutUint32(r.buff[i*8+4:], math.Float32bits(imag(v)))
+	}
+
+	_, err := r.writer.Write(r.buff[:len(data)*8])
+	r.samplesWritten += uint64(len(data))
+	return err
+}
+
+// UpdateParams starts a new capture segment if the radio parameters changed since the last one
+func (r *SigMFRecorder) UpdateParams(frequency, gain float64, antenna string) {
+	r.Lock()
+	defer r.Unlock()
+	if frequency != r.frequency || gain != r.gain || antenna != r.antenna {
+		r.frequency = frequency
+		r.gain = gain
+		r.antenna = antenna
+		r.addCapture()
+	}
+}
+
+// Annotate marks the current position of the recording, spanning the given bandwidth around the current frequency
+func (r *SigMFRecorder) Annotate(label, comment string, bandwidth float64) {
+	r.Lock()
+	defer r.Unlock()
+	var a = SigMFAnnotation{
+		SampleStart: r.samplesWritten,
+		Label:       label,
+		Comment:     comment,
+	}
+	if bandwidth > 0 {
+		a.FreqLowerEdge = r.frequency - bandwidth/2
+		a.FreqUpperEdge = r.frequency + bandwidth/2
+	}
+	r.meta.Annotations = append(r.meta.Annotations, a)
+}
+
+func (r *SigMFRecorder) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.writer.Flush()
+	if err != nil {
+		r.file.Close()
+		r.file = nil
+		return err
+	}
+
+	err = r.file.Close()
+	r.file = nil
+	if err != nil {
+		return err
+	}
+
+	// Open ended annotations last until the end of the recording
+	for i := range r.meta.Annotations {
+		if r.meta.Annotations[i].SampleCount == 0 && r.samplesWritten > r.meta.Annotations[i].SampleStart {
+			r.meta.Annotations[i].SampleCount = r.samplesWritten - r.meta.Annotations[i].SampleStart
+		}
+	}
+
+	data, err := json.MarshalIndent(r.meta, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.basePath+".sigmf-meta", data, 0644)
+}
+
+// endregion
@@ -0,0 +1,35 @@
+package main
+
+// SamplesCallback receives every block of IQ samples produced by a SampleSource
+type SamplesCallback func(data []complex64, channel int, timestamp uint64)
+
+// SampleSource is anything that can feed IQ samples to the DSP chain (a radio, a recording, a network stream...)
+type SampleSource interface {
+	GetName() string
+
+	Open() error
+	Close() error
+	Start() error
+	Stop() error
+
+	SetCallback(cb SamplesCallback)
+
+	SetCenterFrequency(frequency float64) error
+	GetCenterFrequency() float64
+
+	SetSampleRate(sampleRate float64) error
+	GetSampleRate() float64
+
+	// SetGain receives the gain normalized between 0 and 1
+	SetGain(gain float64) error
+	GetGain() float64
+
+	SetAntenna(antenna int) error
+	GetAntenna() int
+	GetAntennas() []string
+}
+
+// FrequencyNotifier is implemented by sources whose center frequency can change by themselves (like recordings with several captures)
+type FrequencyNotifier interface {
+	SetFrequencyCallback(cb func(frequency float64))
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"github.com/golang-ui/nuklear/nk"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	sourceTypeLimeSDR = iota
+	sourceTypeFile
+	sourceTypeRTLTCP
+	sourceTypeGenerator
+)
+
+var sourceTypeNames = []string{"LimeSDR", "IQ File", "rtl_tcp", "Signal Generator"}
+var selectedSourceType = int32(sourceTypeLimeSDR)
+var sourceError = ""
+var sourceLoading TAtomBool
+
+var fileSourcePath = ""
+var fileSourceFormat = int32(IQFormatAuto)
+var fileSourceRateText = "2000000"
+
+// fileSourceLoop is used by files opened at startup, set with -loop
+var fileSourceLoop = true
+
+var rtlTcpAddress = "127.0.0.1:1234"
+
+var generatorRateText = "2000000"
+
+func openSource(src SampleSource) {
+	if sourceLoading.Get() {
+		return
+	}
+	sourceLoading.Set(true)
+	sourceError = ""
+	go func() {
+		defer sourceLoading.Set(false)
+		err := SwitchSource(src)
+		if err != nil {
+			sourceError = err.Error()
+			log.Printf("Error opening %s: %s\n", src.GetName(), err)
+		}
+	}()
+}
+
+func buildSourceMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Source: %s", source.GetName()), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 1)
+	{
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, comboItems(sourceTypeNames), &selectedSourceType, int32(len(sourceTypeNames)), 20, size)
+	}
+
+	switch selectedSourceType {
+	case sourceTypeLimeSDR:
+		nk.NkLayoutRowDynamic(ctx, 25, 1)
+		{
+			if nk.NkButtonLabel(ctx, "Open LimeSDR") > 0 {
+				openSource(MakeLimeSDRSource(0, 0))
+			}
+		}
+	case sourceTypeFile:
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabel(ctx, "File", nk.TextLeft)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 1)
+		{
+			fileSourcePath = editText(ctx, fileSourcePath, 512, nk.NkFilterDefault)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Format", nk.TextLeft)
+			size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+			nk.NkComboboxString(ctx, comboItems(iqFormatNames), &fileSourceFormat, int32(len(iqFormatNames)), 20, size)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Sample Rate", nk.TextLeft)
+			fileSourceRateText = editText(ctx, fileSourceRateText, 16, nk.NkFilterDecimal)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 1)
+		{
+			if nk.NkButtonLabel(ctx, "Open File") > 0 {
+				rate, err := strconv.ParseFloat(fileSourceRateText, 64)
+				if err != nil || rate <= 0 {
+					sourceError = fmt.Sprintf("Invalid sample rate: %s", fileSourceRateText)
+				} else {
+					openSource(MakeFileSource(fileSourcePath, IQFormat(fileSourceFormat), rate, centerFreq))
+				}
+			}
+		}
+	case sourceTypeRTLTCP:
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Address", nk.TextLeft)
+			rtlTcpAddress = editText(ctx, rtlTcpAddress, 128, nk.NkFilterDefault)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 1)
+		{
+			if nk.NkButtonLabel(ctx, "Connect") > 0 {
+				openSource(MakeRTLTCPSource(rtlTcpAddress))
+			}
+		}
+	case sourceTypeGenerator:
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Sample Rate", nk.TextLeft)
+			generatorRateText = editText(ctx, generatorRateText, 16, nk.NkFilterDecimal)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 1)
+		{
+			if nk.NkButtonLabel(ctx, "Start Generator") > 0 {
+				rate, err := strconv.ParseFloat(generatorRateText, 64)
+				if err != nil || rate <= 0 {
+					sourceError = fmt.Sprintf("Invalid sample rate: %s", generatorRateText)
+				} else {
+					openSource(MakeGeneratorSource(rate, centerFreq))
+				}
+			}
+		}
+	}
+
+	if sourceLoading.Get() {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabel(ctx, "Opening...", nk.TextLeft)
+		}
+	} else if sourceError != "" {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabel(ctx, sourceError, nk.TextLeft)
+		}
+	}
+
+	if fs, ok := source.(*FileSource); ok {
+		buildPlaybackMenu(ctx, fs)
+	}
+
+	if rs, ok := source.(*RTLTCPSource); ok {
+		buildRTLTCPMenu(ctx, rs)
+	}
+
+	if gs, ok := source.(*GeneratorSource); ok {
+		buildGeneratorMenu(ctx, gs)
+	}
+
+	buildSharingMenu(ctx)
+}
+
+func buildGeneratorMenu(ctx *nk.Context, gs *GeneratorSource) {
+	var noiseFloor = gs.GetNoiseFloor()
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Noise Floor: %.0f dBFS", noiseFloor), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		var newNoiseFloor = nk.NkSlideFloat(ctx, -120, float32(noiseFloor), 0, 1)
+		if float64(newNoiseFloor) != noiseFloor {
+			gs.SetNoiseFloor(float64(newNoiseFloor))
+		}
+	}
+
+	for _, signal := range gs.GetSignals() {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			var enabled = boolToInt32(signal.Enabled)
+			nk.NkCheckboxLabel(ctx, fmt.Sprintf("%s (%.0f dBFS)", signal, signal.Level), &enabled)
+			if (enabled == 1) != signal.Enabled {
+				gs.UpdateSignal(signal, func(s *GeneratorSignal) {
+					s.Enabled = enabled == 1
+				})
+			}
+		}
+		if signal.Enabled {
+			nk.NkLayoutRowDynamic(ctx, 20, 1)
+			{
+				var level = nk.NkSlideFloat(ctx, -120, float32(signal.Level), 0, 1)
+				if float64(level) != signal.Level {
+					gs.UpdateSignal(signal, func(s *GeneratorSignal) {
+						s.Level = float64(level)
+					})
+				}
+			}
+		}
+	}
+}
+
+func buildSharingMenu(ctx *nk.Context) {
+	var sharing = IsSharing()
+	nk.NkLayoutRowDynamic(ctx, 25, 1)
+	{
+		var share = boolToInt32(sharing)
+		nk.NkCheckboxLabel(ctx, "Share via rtl_tcp", &share)
+		if share == 1 && !sharing {
+			err := StartSharing()
+			if err != nil {
+				sourceError = err.Error()
+				log.Printf("Error starting rtl_tcp server: %s\n", err)
+			}
+		} else if share == 0 && sharing {
+			StopSharing()
+		}
+	}
+	if sharing {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabel(ctx, fmt.Sprintf("%s - %d client(s)", rtlTcpServerAddress, SharingClientCount()), nk.TextLeft)
+		}
+	} else {
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Listen", nk.TextLeft)
+			rtlTcpServerAddress = editText(ctx, rtlTcpServerAddress, 128, nk.NkFilterDefault)
+		}
+	}
+}
+
+func buildRTLTCPMenu(ctx *nk.Context, rs *RTLTCPSource) {
+	var info = rs.GetDongleInfo()
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Tuner: %s (%d gains)", info.TunerName(), info.GainCount), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		var autoGain = boolToInt32(rs.IsAutoGain())
+		nk.NkCheckboxLabel(ctx, "Auto Gain", &autoGain)
+		if (autoGain == 1) != rs.IsAutoGain() {
+			rs.SetAutoGain(autoGain == 1)
+		}
+		var agc = boolToInt32(rs.IsAGC())
+		nk.NkCheckboxLabel(ctx, "RTL AGC", &agc)
+		if (agc == 1) != rs.IsAGC() {
+			rs.SetAGC(agc == 1)
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Frequency Correction: %d ppm", rs.GetPPM()), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		var ppm = nk.NkSlideInt(ctx, -100, rs.GetPPM(), 100, 1)
+		if ppm != rs.GetPPM() {
+			rs.SetPPM(ppm)
+		}
+	}
+}
+
+func buildPlaybackMenu(ctx *nk.Context, fs *FileSource) {
+	var position = fs.GetPosition()
+	var duration = fs.GetDuration()
+
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Position: %s / %s", formatDuration(position), formatDuration(duration)), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		var pos = float32(position.Seconds() / duration.Seconds())
+		var newPos = nk.NkSlideFloat(ctx, 0, pos, 1, 0.001)
+		if math.Abs(float64(newPos-pos)) > 0.002 {
+			fs.Seek(time.Duration(float64(duration) * float64(newPos)))
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		if fs.IsPaused() {
+			if nk.NkButtonLabel(ctx, "Resume") > 0 {
+				fs.SetPaused(false)
+			}
+		} else {
+			if nk.NkButtonLabel(ctx, "Pause") > 0 {
+				fs.SetPaused(true)
+			}
+		}
+		var loop = boolToInt32(fs.IsLooping())
+		nk.NkCheckboxLabel(ctx, "Loop", &loop)
+		if (loop == 1) != fs.IsLooping() {
+			fs.SetLoop(loop == 1)
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Speed", nk.TextLeft)
+		var speedNames = make([]string, len(playbackSpeeds))
+		var selected = int32(0)
+		for i, v := range playbackSpeeds {
+			speedNames[i] = fmt.Sprintf("%gx", v)
+			if v == fs.GetSpeed() {
+				selected = int32(i)
+			}
+		}
+		var newSelected = selected
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, comboItems(speedNames), &newSelected, int32(len(speedNames)), 20, size)
+		if newSelected != selected {
+			fs.SetSpeed(playbackSpeeds[newSelected])
+		}
+	}
+
+	var meta = fs.GetSigMFMeta()
+	if meta != nil {
+		var sample = fs.GetSamplePosition()
+		var capture = meta.CaptureAt(sample)
+		if meta.Global.HW != "" {
+			nk.NkLayoutRowDynamic(ctx, 20, 1)
+			{
+				nk.NkLabel(ctx, fmt.Sprintf("Recorded with: %s", meta.Global.HW), nk.TextLeft)
+			}
+		}
+		if capture != nil && capture.Datetime != "" {
+			nk.NkLayoutRowDynamic(ctx, 20, 1)
+			{
+				nk.NkLabel(ctx, capture.Datetime, nk.TextLeft)
+			}
+		}
+		for _, a := range meta.AnnotationsAt(sample) {
+			nk.NkLayoutRowDynamic(ctx, 20, 1)
+			{
+				nk.NkLabel(ctx, fmt.Sprintf("> %s %s", a.Label, a.Comment), nk.TextLeft)
+			}
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package main
 
-import "sync/atomic"
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
 
 var subMultiples = []string{"", "m", "µ", "n", "p", "f", "a", "z", "y"}
 var multiples = []string{"", "k", "M", "G", "T", "P", "E", "Z", "Y"}
@@ -60,3 +65,31 @@ func (b *TAtomBool) Get() bool {
 	}
 	return false
 }
+
+type TAtomCounter struct{ value uint32 }
+
+func (c *TAtomCounter) Increment() {
+	atomic.AddUint32(&(c.value), 1)
+}
+
+func (c *TAtomCounter) Get() uint32 {
+	return atomic.LoadUint32(&(c.value))
+}
+
+// comboItems builds the zero separated item list used by nk.NkComboboxString
+func comboItems(items []string) string {
+	return strings.Join(items, "\x00")
+}
+
+func formatDuration(d time.Duration) string {
+	var seconds = int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, (seconds/60)%60, seconds%60)
+}
+
+// boolToInt32 converts a bool to the int32 flag used by nuklear checkboxes
+func boolToInt32(v bool) int32 {
+	if v {
+		return 1
+	}
+	return 0
+}
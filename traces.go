@@ -0,0 +1,104 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"time"
+)
+
+// spectrumTrace is a spectrum drawn over the live FFT line, built from the instantaneous (not averaged) spectra
+type spectrumTrace struct {
+	Enabled bool
+	Color   color.Color
+	data    []float32
+}
+
+var maxHoldTrace = &spectrumTrace{Color: color.NRGBA{R: 255, G: 64, B: 64, A: 255}}
+var minHoldTrace = &spectrumTrace{Color: color.NRGBA{R: 64, G: 128, B: 255, A: 255}}
+var peakDecayTrace = &spectrumTrace{Color: color.NRGBA{R: 255, G: 200, B: 0, A: 255}}
+
+// traceFloor replaces the bins without power (-Inf) or invalid (NaN), they would stick in the min hold trace
+const traceFloor = -200
+
+// peakDecayRate is how fast the decaying peak trace falls, in dB per second
+var peakDecayRate = float32(10)
+
+var traceCenterFrequency float64
+var traceSampleRate float64
+var lastTraceUpdate = time.Now()
+
+func ResetTraces() {
+	maxHoldTrace.data = nil
+	minHoldTrace.data = nil
+	peakDecayTrace.data = nil
+}
+
+// updateTraces adds an instantaneous spectrum to the traces. They restart when the spectrum layout changes.
+func updateTraces(row waterfallRow) {
+	if row.centerFrequency != traceCenterFrequency || row.sampleRate != traceSampleRate {
+		traceCenterFrequency = row.centerFrequency
+		traceSampleRate = row.sampleRate
+		ResetTraces()
+	}
+
+	var elapsed = float32(time.Since(lastTraceUpdate).Seconds())
+	lastTraceUpdate = time.Now()
+
+	var spectrum = make([]float32, len(row.spectrum))
+	for i, v := range row.spectrum {
+		if math.IsNaN(float64(v)) || v < traceFloor {
+			v = traceFloor
+		}
+		spectrum[i] = v
+	}
+
+	for _, t := range []*spectrumTrace{maxHoldTrace, minHoldTrace, peakDecayTrace} {
+		if !t.Enabled {
+			t.data = nil
+			continue
+		}
+		if len(t.data) != len(spectrum) {
+			t.data = append([]float32(nil), spectrum...)
+			continue
+		}
+		for i, v := range spectrum {
+			switch t {
+			case maxHoldTrace:
+				t.data[i] = float32(math.Max(float64(t.data[i]), float64(v)))
+			case minHoldTrace:
+				t.data[i] = float32(math.Min(float64(t.data[i]), float64(v)))
+			case peakDecayTrace:
+				t.data[i] = float32(math.Max(float64(t.data[i]-peakDecayRate*elapsed), float64(v)))
+			}
+		}
+	}
+}
+
+func drawTraces(img *image.RGBA) {
+	for _, t := range []*spectrumTrace{minHoldTrace, peakDecayTrace, maxHoldTrace} {
+		if t.data == nil {
+			continue
+		}
+		var row = waterfallRow{
+			spectrum:        t.data,
+			centerFrequency: traceCenterFrequency,
+			sampleRate:      traceSampleRate,
+		}
+		var lastX, lastY float32
+		var hasLast = false
+		for i, s := range spectrumPixels(row, imgWidth) {
+			if math.IsNaN(float64(s)) || math.IsInf(float64(s), 0) {
+				hasLast = false
+				continue
+			}
+			var y = float32(math.Max(0, math.Min(fftHeight-1, float64((fftOffset-s)*fftScale))))
+			if hasLast {
+				DrawLine(lastX, lastY, float32(i), y, t.Color, img)
+			}
+			hasLast = true
+			lastX = float32(i)
+			lastY = y
+		}
+	}
+}
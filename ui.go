@@ -8,12 +8,15 @@ import (
 	"github.com/golang-ui/nuklear/nk"
 	"github.com/racerxdl/segdsp/tools"
 	"image"
+	"image/color"
 	"image/draw"
 	"image/png"
 	"log"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -29,6 +32,11 @@ var playButton nk.Image
 var playButtonTex int32
 var stopButton nk.Image
 var stopButtonTex int32
+var recordButton nk.Image
+var recordButtonTex int32
+var recordingButton nk.Image
+var recordingButtonTex int32
+var annotationText = ""
 var monoAtlas *nk.FontAtlas
 var sansAtlas *nk.FontAtlas
 var frequencySelector = MakeUIFrequencySelector(100e3, 3.8e9)
@@ -58,9 +66,34 @@ func InitializeImages() {
 	m = image.NewRGBA(img.Bounds())
 	draw.Draw(m, m.Bounds(), img, img.Bounds().Min, draw.Over)
 	stopButton, stopButtonTex = rgbaTex(stopButtonTex, m)
+
+	recordButtonTex = -1
+	recordingButtonTex = -1
+	recordButton, recordButtonTex = rgbaTex(recordButtonTex, makeRecordImage(32, false))
+	recordingButton, recordingButtonTex = rgbaTex(recordingButtonTex, makeRecordImage(32, true))
 	InitFrequencySelectorImages()
 }
 
+// makeRecordImage draws the record button icon. A red dot when idle, a red dot with a white square when recording.
+func makeRecordImage(size int, recording bool) *image.RGBA {
+	var m = image.NewRGBA(image.Rect(0, 0, size, size))
+	var c = float64(size) / 2
+	var r = float64(size) * 0.35
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var dx = float64(x) + 0.5 - c
+			var dy = float64(y) + 0.5 - c
+			if dx*dx+dy*dy <= r*r {
+				m.Set(x, y, color.NRGBA{R: 220, G: 30, B: 30, A: 255})
+				if recording && math.Abs(dx) < r/2.5 && math.Abs(dy) < r/2.5 {
+					m.Set(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+				}
+			}
+		}
+	}
+	return m
+}
+
 func InitializeFonts() {
 	var freeSansBytes = MustAsset("assets/FreeSans.ttf")
 	var freeMonoBytes = MustAsset("assets/FreeMono.ttf")
@@ -100,13 +133,21 @@ func rgbaTex(tex int32, rgba *image.RGBA) (nk.Image, int32) {
 
 var centerFreqText = ""
 
+// editText shows a single line text edit and returns its new content
+func editText(ctx *nk.Context, text string, maxLength int, filter nk.PluginFilter) string {
+	var buff = make([]byte, maxLength)
+	copy(buff, []byte(text))
+	nk.NkEditStringZeroTerminated(ctx, nk.EditSimple, buff, int32(maxLength), filter)
+	return strings.Split(string(buff), "\x00")[0]
+}
+
 func buildSideMenu(win *glfw.Window, ctx *nk.Context) {
 	nk.NkStyleSetFont(ctx, fonts["sans16"].Handle())
 	width, height := win.GetSize()
 	bounds := nk.NkRect(float32(width)-256, 0, 256, float32(height))
 	update := nk.NkBegin(ctx, "Configuration", bounds, nk.WindowTitle|nk.WindowBorder)
 	if update > 0 {
-		nk.NkLayoutRowStatic(ctx, 32, int32(32), 1)
+		nk.NkLayoutRowStatic(ctx, 32, int32(32), 2)
 		{
 			if IsRunning() {
 				if nk.NkButtonImage(ctx, stopButton) > 0 {
@@ -117,8 +158,34 @@ func buildSideMenu(win *glfw.Window, ctx *nk.Context) {
 					Start()
 				}
 			}
+			// Hover is checked on the bounds of the next widget, so before the button is drawn
+			if nk.NkWidgetIsHovered(ctx) > 0 {
+				nk.NkTooltip(ctx, "Record IQ")
+			}
+			if IsRecording() {
+				if nk.NkButtonImage(ctx, recordingButton) > 0 {
+					StopRecording()
+				}
+			} else {
+				if nk.NkButtonImage(ctx, recordButton) > 0 {
+					err := StartRecording()
+					if err != nil {
+						log.Printf("Error starting recording: %s\n", err)
+					}
+				}
+			}
 		}
 
+		buildRecordingMenu(ctx)
+
+		buildSourceMenu(ctx)
+
+		buildProfilesMenu(ctx)
+
+		buildBookmarksMenu(ctx)
+
+		buildScannerMenu(ctx)
+
 		nk.NkLayoutRowDynamic(ctx, 20, 1)
 		{
 			nk.NkLabel(ctx, fmt.Sprintf("Averaging: %f", acc), nk.TextLeft)
@@ -144,6 +211,22 @@ func buildSideMenu(win *glfw.Window, ctx *nk.Context) {
 			fftLock.Unlock()
 		}
 
+		buildWindowMenu(ctx)
+
+		buildZoomMenu(ctx)
+
+		buildTracesMenu(ctx)
+
+		buildMarkersMenu(ctx)
+
+		buildLevelsMenu(ctx)
+
+		buildPaletteMenu(ctx)
+
+		buildWaterfallMenu(ctx)
+
+		buildBandPlanMenu(ctx)
+
 		nk.NkLayoutRowDynamic(ctx, 20, 1)
 		{
 			nk.NkLabel(ctx, fmt.Sprintf("Gain: %f", gain), nk.TextLeft)
@@ -151,9 +234,8 @@ func buildSideMenu(win *glfw.Window, ctx *nk.Context) {
 		nk.NkLayoutRowDynamic(ctx, 20, 1)
 		{
 			newGain := nk.NkSlideFloat(ctx, 0, float32(gain), 1, 0.01)
-			gain = float64(newGain)
-			if tools.AlmostFloatEqual(newGain, float32(gain)) && dev != nil {
-				dev.RXChannels[channel].SetGainNormalized(float64(newGain))
+			if !tools.AlmostFloatEqual(newGain, float32(gain)) {
+				SetGain(float64(newGain))
 			}
 		}
 
@@ -164,23 +246,16 @@ func buildSideMenu(win *glfw.Window, ctx *nk.Context) {
 		nk.NkLayoutRowDynamic(ctx, 25, 1)
 		{
 			size := nk.NkVec2(nk.NkWidgetWidth(ctx), 400)
-			lastAntenna := antenna
-			nk.NkComboboxString(ctx, antennaStringData, &antenna, antennaCount, 20, size)
-			var isR = IsRunning()
-			if lastAntenna != antenna && dev != nil {
-				if isR {
-					Stop()
-				}
-				dev.RXChannels[channel].SetAntenna(int(antenna))
-				if isR {
-					Start()
-				}
+			var newAntenna = antenna
+			nk.NkComboboxString(ctx, antennaStringData, &newAntenna, antennaCount, 20, size)
+			if newAntenna != antenna {
+				SetAntenna(newAntenna)
 			}
 		}
 
 		nk.NkLayoutRowDynamic(ctx, 20, 1)
 		{
-			nk.NkLabel(ctx, fmt.Sprintf("Frequency: %.0f", centerFreq), nk.TextLeft)
+			nk.NkLabel(ctx, fmt.Sprintf("Center Frequency: %.0f", centerFreq), nk.TextLeft)
 		}
 		nk.NkLayoutRowDynamic(ctx, 25, 1)
 		{
@@ -197,20 +272,736 @@ func buildSideMenu(win *glfw.Window, ctx *nk.Context) {
 					log.Printf("Error: %s\n", err)
 					centerFreqText = fmt.Sprintf("%d", int(centerFreq))
 				} else if centerFreq < 3.8e9 && centerFreq >= 100e3 {
-					centerFreq = f
-					if dev != nil {
-						dev.RXChannels[channel].SetCenterFrequency(centerFreq)
-					}
-					frequencySelector.SetFrequency(uint32(centerFreq))
+					SetCenterFrequency(f)
 				} else {
 					log.Printf("Invalid Frequency: %f\n", f)
 				}
 			}
 		}
+
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Tuning Step", nk.TextLeft)
+			size := nk.NkVec2(nk.NkWidgetWidth(ctx), 400)
+			nk.NkComboboxString(ctx, comboItems(tuningStepNames()), &selectedTuningStep, int32(len(tuningSteps)), 20, size)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			var offset = boolToInt32(offsetTuning)
+			nk.NkCheckboxLabel(ctx, "Offset Tuning", &offset)
+			if (offset == 1) != offsetTuning {
+				SetOffsetTuning(offset == 1)
+			}
+			v, unit := toNotationUnit(float32(math.Abs(GetVFOOffset())))
+			var sign = "+"
+			if GetVFOOffset() < 0 {
+				sign = "-"
+			}
+			nk.NkLabel(ctx, fmt.Sprintf("VFO %s%.1f %sHz", sign, v, unit), nk.TextRight)
+		}
+
+		buildDemodMenu(ctx)
+
+		buildMeasurementsMenu(ctx)
 	}
 	nk.NkEnd(ctx)
 }
 
+var profileName = ""
+
+func buildProfilesMenu(ctx *nk.Context) {
+	if len(profiles) > 0 {
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Profile", nk.TextLeft)
+			var names = make([]string, len(profiles))
+			for i, p := range profiles {
+				names[i] = p.Name
+			}
+			size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+			nk.NkComboboxString(ctx, comboItems(names), &selectedProfile, int32(len(names)), 20, size)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			if nk.NkButtonLabel(ctx, "Apply") > 0 {
+				ApplyProfile(profiles[selectedProfile])
+			}
+			if nk.NkButtonLabel(ctx, "Delete") > 0 {
+				DeleteProfile(selectedProfile)
+			}
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		profileName = editText(ctx, profileName, 64, nk.NkFilterDefault)
+		if nk.NkButtonLabel(ctx, "Save Profile") > 0 && strings.TrimSpace(profileName) != "" {
+			SaveProfile(strings.TrimSpace(profileName))
+			profileName = ""
+		}
+	}
+}
+
+var bookmarkName = ""
+var bookmarkTags = ""
+var bookmarkColor = int32(0)
+var bookmarkFilter = ""
+var bookmarkFile = "bookmarks.csv"
+var bookmarkMessage = ""
+
+func buildBookmarksMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Bookmarks: %d", len(bookmarks)), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Filter Tag", nk.TextLeft)
+		bookmarkFilter = editText(ctx, bookmarkFilter, 64, nk.NkFilterDefault)
+	}
+	// Iterate over a copy, bookmarks can be removed inside the loop
+	for i, b := range append([]Bookmark(nil), bookmarks...) {
+		if !b.HasTag(strings.TrimSpace(bookmarkFilter)) {
+			continue
+		}
+		var c = b.RGBA()
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			v, unit := toNotationUnit(float32(b.Frequency))
+			nk.NkLabelColored(ctx, fmt.Sprintf("%s %.4f %sHz %s", b.Name, v, unit, b.Mode), nk.TextLeft, nk.NkRgba(int32(c.R), int32(c.G), int32(c.B), 255))
+		}
+		nk.NkLayoutRowDynamic(ctx, 20, 2)
+		{
+			if nk.NkButtonLabel(ctx, "Tune") > 0 {
+				TuneBookmark(b)
+			}
+			if nk.NkButtonLabel(ctx, "Remove") > 0 {
+				RemoveBookmark(i)
+			}
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Name", nk.TextLeft)
+		bookmarkName = editText(ctx, bookmarkName, 64, nk.NkFilterDefault)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Tags", nk.TextLeft)
+		bookmarkTags = editText(ctx, bookmarkTags, 128, nk.NkFilterDefault)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, comboItems(bookmarkColorNames), &bookmarkColor, int32(len(bookmarkColorNames)), 20, size)
+		if nk.NkButtonLabel(ctx, "Add Bookmark") > 0 {
+			var name = strings.TrimSpace(bookmarkName)
+			if name == "" {
+				v, unit := toNotationUnit(float32(vfoFrequency))
+				name = fmt.Sprintf("%.4f %sHz", v, unit)
+			}
+			AddBookmark(CurrentBookmark(name, parseTags(bookmarkTags), bookmarkColors[bookmarkColor]))
+			bookmarkName = ""
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 1)
+	{
+		bookmarkFile = editText(ctx, bookmarkFile, 256, nk.NkFilterDefault)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		if nk.NkButtonLabel(ctx, "Import CSV") > 0 {
+			n, err := ImportGQRXBookmarks(bookmarkFile)
+			if err != nil {
+				log.Printf("Error importing bookmarks: %s\n", err)
+				bookmarkMessage = err.Error()
+			} else {
+				bookmarkMessage = fmt.Sprintf("Imported %d bookmarks", n)
+			}
+		}
+		if nk.NkButtonLabel(ctx, "Export CSV") > 0 {
+			err := ExportGQRXBookmarks(bookmarkFile)
+			if err != nil {
+				log.Printf("Error exporting bookmarks: %s\n", err)
+				bookmarkMessage = err.Error()
+			} else {
+				bookmarkMessage = fmt.Sprintf("Exported %d bookmarks", len(bookmarks))
+			}
+		}
+	}
+	if bookmarkMessage != "" {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabel(ctx, bookmarkMessage, nk.TextLeft)
+		}
+	}
+}
+
+var scanStartText = ""
+var scanStopText = ""
+var scanError = ""
+
+func buildScannerMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Scan", nk.TextLeft)
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, comboItems(scanSourceNames), &scanSource, int32(len(scanSourceNames)), 20, size)
+	}
+	if scanSource == scanSourceRange {
+		if scanStartText == "" {
+			scanStartText = fmt.Sprintf("%.0f", scanStart)
+		}
+		if scanStopText == "" {
+			scanStopText = fmt.Sprintf("%.0f", scanStop)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Start", nk.TextLeft)
+			scanStartText = editText(ctx, scanStartText, 16, nk.NkFilterDefault)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Stop", nk.TextLeft)
+			scanStopText = editText(ctx, scanStopText, 16, nk.NkFilterDefault)
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Step", nk.TextLeft)
+			var step = tuningStepIndex(scanStep)
+			size := nk.NkVec2(nk.NkWidgetWidth(ctx), 400)
+			nk.NkComboboxString(ctx, comboItems(tuningStepNames()), &step, int32(len(tuningSteps)), 20, size)
+			scanStep = tuningSteps[step]
+		}
+	} else {
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "Tag", nk.TextLeft)
+			scanTag = editText(ctx, scanTag, 64, nk.NkFilterDefault)
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		var power = "---"
+		if IsScanning() && !math.IsInf(float64(GetScanPower()), 0) {
+			power = fmt.Sprintf("%.1f dB", GetScanPower())
+		}
+		nk.NkLabel(ctx, fmt.Sprintf("Squelch: %.0f dB (now %s)", scanSquelch, power), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		scanSquelch = nk.NkSlideFloat(ctx, -140, scanSquelch, 0, 1)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 2)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Dwell: %d ms", scanDwell/time.Millisecond), nk.TextLeft)
+		scanDwell = time.Duration(nk.NkSlideInt(ctx, 20, int32(scanDwell/time.Millisecond), 1000, 10)) * time.Millisecond
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 2)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Hang: %.1f s", scanHang.Seconds()), nk.TextLeft)
+		scanHang = time.Duration(nk.NkSlideFloat(ctx, 0, float32(scanHang.Seconds()), 10, 0.1) * float32(time.Second))
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 1)
+	{
+		if IsScanning() {
+			if nk.NkButtonLabel(ctx, "Stop Scan") > 0 {
+				StopScan()
+			}
+		} else if nk.NkButtonLabel(ctx, "Start Scan") > 0 {
+			scanError = ""
+			if scanSource == scanSourceRange {
+				start, err := parseFrequency(scanStartText)
+				if err == nil {
+					scanStart = start
+					var stop float64
+					stop, err = parseFrequency(scanStopText)
+					scanStop = stop
+				}
+				if err != nil {
+					scanError = err.Error()
+				}
+			}
+			if scanError == "" {
+				StartScan()
+				if !IsScanning() {
+					scanError = "Nothing to scan"
+				}
+			}
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, GetScanStatus(), nk.TextLeft)
+	}
+	if scanError != "" {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabelColored(ctx, scanError, nk.TextLeft, nk.NkRgba(255, 64, 64, 255))
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 3)
+	{
+		if nk.NkButtonLabel(ctx, "Skip") > 0 {
+			SkipChannel()
+		}
+		if nk.NkButtonLabel(ctx, "Lockout") > 0 {
+			LockoutChannel(vfoFrequency)
+		}
+		var priority = "Priority"
+		if IsPriorityChannel(vfoFrequency) {
+			priority = "Normal"
+		}
+		if nk.NkButtonLabel(ctx, priority) > 0 {
+			TogglePriorityChannel(vfoFrequency)
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Lockouts: %d", len(scanLockouts)), nk.TextLeft)
+		if nk.NkButtonLabel(ctx, "Clear Lockouts") > 0 {
+			ClearLockouts()
+		}
+	}
+}
+
+func buildWindowMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Window", nk.TextLeft)
+		var windowType = int32(fftWindowType)
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, comboItems(fftWindowNames), &windowType, int32(len(fftWindowNames)), 20, size)
+		fftWindowType = FFTWindowType(windowType)
+	}
+	if fftWindowType == WindowKaiser {
+		nk.NkLayoutRowDynamic(ctx, 20, 2)
+		{
+			nk.NkLabel(ctx, fmt.Sprintf("Beta: %.1f", kaiserBeta), nk.TextLeft)
+			kaiserBeta = float64(nk.NkSlideFloat(ctx, 0, float32(kaiserBeta), 20, 0.5))
+		}
+	}
+}
+
+func buildZoomMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Zoom", nk.TextLeft)
+		var zoom = int32(math.Log2(spectrumZoom))
+		var newZoom = zoom
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, spectrumZoomNames, &newZoom, 7, 20, size)
+		if newZoom != zoom {
+			// Zoom around the VFO when it is visible
+			var anchor = GetVisibleCenter()
+			if math.Abs(vfoFrequency-anchor) < GetVisibleSpan()/2 {
+				anchor = vfoFrequency
+			}
+			SetSpectrumZoom(math.Pow(2, float64(newZoom)), anchor)
+		}
+	}
+	if spectrumZoom > 1 {
+		var maxPan = float32(sampleRate-GetVisibleSpan()) / 2
+		var pan = float32(GetVisibleCenter() - centerFreq)
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			var newPan = nk.NkSlideFloat(ctx, -maxPan, pan, maxPan, maxPan/100)
+			if !tools.AlmostFloatEqual(newPan, pan) {
+				SetSpectrumPan(float64(newPan))
+			}
+		}
+	}
+}
+
+func buildTracesMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 25, 3)
+	{
+		for _, t := range []struct {
+			label string
+			trace *spectrumTrace
+		}{{"Max", maxHoldTrace}, {"Min", minHoldTrace}, {"Peak", peakDecayTrace}} {
+			var enabled = boolToInt32(t.trace.Enabled)
+			nk.NkCheckboxLabel(ctx, t.label, &enabled)
+			t.trace.Enabled = enabled == 1
+		}
+	}
+	if peakDecayTrace.Enabled {
+		nk.NkLayoutRowDynamic(ctx, 20, 2)
+		{
+			nk.NkLabel(ctx, fmt.Sprintf("Decay: %.0f dB/s", peakDecayRate), nk.TextLeft)
+			peakDecayRate = nk.NkSlideFloat(ctx, 1, peakDecayRate, 60, 1)
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 1)
+	{
+		if nk.NkButtonLabel(ctx, "Reset Traces") > 0 {
+			ResetTraces()
+		}
+	}
+}
+
+func formatFrequencyDelta(delta float64) string {
+	v, unit := toNotationUnit(float32(math.Abs(delta)))
+	var sign = "+"
+	if delta < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%s%.2f %sHz", sign, v, unit)
+}
+
+func buildMarkersMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		if nk.NkButtonLabel(ctx, "Add Marker") > 0 {
+			AddMarker(vfoFrequency)
+		}
+		if nk.NkButtonLabel(ctx, "Clear Markers") > 0 {
+			ClearMarkers()
+		}
+	}
+	// Iterate over a copy, markers can be removed inside the loop
+	for i, m := range append([]*Marker(nil), markers...) {
+		var level, ok = m.Level()
+		var levelText = "---"
+		if ok {
+			levelText = fmt.Sprintf("%.1f dB", level)
+		}
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			// Same colour as the marker on the spectrum
+			var r, g, b, a = markerColors[i%len(markerColors)].RGBA()
+			var c = nk.NkRgba(int32(r>>8), int32(g>>8), int32(b>>8), int32(a>>8))
+			nk.NkLabelColored(ctx, fmt.Sprintf("M%d %s %s", i+1, m.FrequencyString(), levelText), nk.TextLeft, c)
+		}
+		if i > 0 {
+			nk.NkLayoutRowDynamic(ctx, 20, 1)
+			{
+				var df, dl, ok = MarkerDelta(m, markers[0])
+				var text = fmt.Sprintf("  M%d-M1 %s", i+1, formatFrequencyDelta(df))
+				if ok {
+					text += fmt.Sprintf(" %+.1f dB", dl)
+				}
+				nk.NkLabel(ctx, text, nk.TextLeft)
+			}
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 4)
+		{
+			if nk.NkButtonLabel(ctx, "Peak") > 0 {
+				m.ToPeak()
+			}
+			if nk.NkButtonLabel(ctx, "<") > 0 {
+				m.NextPeak(-1)
+			}
+			if nk.NkButtonLabel(ctx, ">") > 0 {
+				m.NextPeak(1)
+			}
+			if nk.NkButtonLabel(ctx, "X") > 0 {
+				RemoveMarker(m)
+			}
+		}
+	}
+}
+
+var waterfallExportMessage = ""
+
+func buildWaterfallMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 20, 2)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Lines/s: %.0f", waterfallLineRate), nk.TextLeft)
+		waterfallLineRate = nk.NkSlideFloat(ctx, 1, waterfallLineRate, 60, 1)
+	}
+	if maxWaterfallScroll() > 0 {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			var back = time.Duration(0)
+			if waterfallScroll < len(waterfallRows) {
+				back = waterfallRows[0].time.Sub(waterfallRows[waterfallScroll].time)
+			}
+			nk.NkLabel(ctx, fmt.Sprintf("History: -%s of %s", formatDuration(back), formatDuration(GetWaterfallDuration())), nk.TextLeft)
+		}
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			var scroll = nk.NkSlideInt(ctx, 0, int32(waterfallScroll), int32(maxWaterfallScroll()), 1)
+			if int(scroll) != waterfallScroll {
+				SetWaterfallScroll(int(scroll))
+			}
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 1)
+	{
+		if nk.NkButtonLabel(ctx, "Export Waterfall") > 0 {
+			name, err := ExportWaterfall(recordingDir)
+			if err != nil {
+				log.Printf("Error exporting waterfall: %s\n", err)
+				waterfallExportMessage = err.Error()
+			} else {
+				waterfallExportMessage = fmt.Sprintf("Saved %s", name)
+			}
+		}
+	}
+	if waterfallExportMessage != "" {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabel(ctx, waterfallExportMessage, nk.TextLeft)
+		}
+	}
+}
+
+func buildBandPlanMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		var show = boolToInt32(showBandPlan)
+		nk.NkCheckboxLabel(ctx, "Band Plan", &show)
+		showBandPlan = show == 1
+		var region = int32(bandPlanRegion - 1)
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, comboItems(bandPlanRegionNames), &region, int32(len(bandPlanRegionNames)), 20, size)
+		bandPlanRegion = int(region) + 1
+	}
+	var names = ""
+	for _, b := range BandsAt(vfoFrequency) {
+		if names != "" {
+			names += ", "
+		}
+		names += b.Name
+	}
+	if names != "" {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabel(ctx, fmt.Sprintf("Band: %s", names), nk.TextLeft)
+		}
+	}
+}
+
+var paletteFile = ""
+var paletteError = ""
+
+func buildPaletteMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Palette", nk.TextLeft)
+		var names = paletteNames()
+		var palette = selectedPalette
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, comboItems(names), &palette, int32(len(names)), 20, size)
+		if palette != selectedPalette {
+			SetPalette(palette)
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		paletteFile = editText(ctx, paletteFile, 256, nk.NkFilterDefault)
+		if nk.NkButtonLabel(ctx, "Load Palette") > 0 {
+			paletteError = ""
+			err := LoadPaletteFile(paletteFile)
+			if err != nil {
+				log.Printf("Error loading palette: %s\n", err)
+				paletteError = err.Error()
+			}
+		}
+	}
+	if paletteError != "" {
+		nk.NkLayoutRowDynamic(ctx, 20, 1)
+		{
+			nk.NkLabelColored(ctx, paletteError, nk.TextLeft, nk.NkRgba(255, 64, 64, 255))
+		}
+	}
+}
+
+func buildLevelsMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Ref Level: %.0f dB", fftOffset), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		fftOffset = nk.NkSlideFloat(ctx, -160, fftOffset, 40, 1)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "dB / div", nk.TextLeft)
+		var names = make([]string, len(dbPerDivSteps))
+		var selected = int32(0)
+		for i, step := range dbPerDivSteps {
+			names[i] = fmt.Sprintf("%.0f dB", step)
+			if step == fftDBPerDiv {
+				selected = int32(i)
+			}
+		}
+		var newSelected = selected
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		nk.NkComboboxString(ctx, comboItems(names), &newSelected, int32(len(names)), 20, size)
+		if newSelected != selected {
+			SetDBPerDiv(dbPerDivSteps[newSelected])
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Waterfall: %.0f to %.0f dB", waterfallMin, waterfallMax), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 2)
+	{
+		waterfallMin = nk.NkSlideFloat(ctx, -160, waterfallMin, waterfallMax-1, 1)
+		waterfallMax = nk.NkSlideFloat(ctx, waterfallMin+1, waterfallMax, 40, 1)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 1)
+	{
+		if nk.NkButtonLabel(ctx, "Auto Range") > 0 {
+			AutoRange()
+		}
+	}
+}
+
+func buildMeasurementsMenu(ctx *nk.Context) {
+	var m = GetChannelMeasurement()
+	if !m.Valid {
+		return
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Channel Power: %.1f dBFS", m.ChannelPower), nk.TextLeft)
+		v, unit := toNotationUnit(float32(m.OccupiedBandwidth))
+		nk.NkLabel(ctx, fmt.Sprintf("Occupied BW (99%%): %.2f %sHz", v, unit), nk.TextLeft)
+		nk.NkLabel(ctx, fmt.Sprintf("Noise Floor: %.1f dBFS/Hz", m.NoiseFloor), nk.TextLeft)
+		nk.NkLabel(ctx, fmt.Sprintf("SNR: %.1f dB", m.SNR), nk.TextLeft)
+	}
+}
+
+func buildDemodMenu(ctx *nk.Context) {
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		nk.NkLabel(ctx, "Mode", nk.TextLeft)
+		size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+		var mode = int32(demodMode)
+		nk.NkComboboxString(ctx, comboItems(demodModeNames), &mode, int32(len(demodModeNames)), 20, size)
+		if DemodMode(mode) != demodMode {
+			SetDemodMode(DemodMode(mode))
+		}
+	}
+	var info = demodModes[demodMode]
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		v, unit := toNotationUnit(float32(demodBandwidth))
+		nk.NkLabel(ctx, fmt.Sprintf("Bandwidth: %.2f %sHz", v, unit), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		var step = float32(info.minBandwidth / 10)
+		var newBandwidth = nk.NkSlideFloat(ctx, float32(info.minBandwidth), float32(demodBandwidth), float32(info.maxBandwidth), step)
+		if !tools.AlmostFloatEqual(newBandwidth, float32(demodBandwidth)) {
+			SetDemodBandwidth(float64(newBandwidth))
+		}
+	}
+	if demodMode == ModeWFM {
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			var mono = boolToInt32(forceMono)
+			nk.NkCheckboxLabel(ctx, "Force Mono", &mono)
+			if (mono == 1) != forceMono {
+				SetForceMono(mono == 1)
+			}
+			if IsStereo() {
+				nk.NkLabelColored(ctx, "STEREO", nk.TextCentered, nk.NkRgba(64, 220, 64, 255))
+			} else {
+				nk.NkLabel(ctx, "MONO", nk.TextCentered)
+			}
+		}
+		nk.NkLayoutRowDynamic(ctx, 25, 2)
+		{
+			nk.NkLabel(ctx, "De-emphasis", nk.TextLeft)
+			var tau = int32(0)
+			if deemphasisTau == deemphasis75us {
+				tau = 1
+			}
+			var newTau = tau
+			size := nk.NkVec2(nk.NkWidgetWidth(ctx), 200)
+			nk.NkComboboxString(ctx, "50 us\x0075 us", &newTau, 2, 20, size)
+			if newTau != tau {
+				if newTau == 1 {
+					SetDeemphasis(deemphasis75us)
+				} else {
+					SetDeemphasis(deemphasis50us)
+				}
+			}
+		}
+	}
+}
+
+func buildRDSPanel(ctx *nk.Context) {
+	var info = GetRDSInfo()
+	nk.NkLayoutRowDynamic(ctx, 20, 5)
+	{
+		if info.Synced {
+			nk.NkLabelColored(ctx, "RDS", nk.TextLeft, nk.NkRgba(64, 220, 64, 255))
+		} else {
+			nk.NkLabel(ctx, "RDS", nk.TextLeft)
+		}
+		var pi = ""
+		if info.Groups > 0 {
+			pi = fmt.Sprintf("%04X %s", info.PI, info.CallSign)
+		}
+		nk.NkLabel(ctx, fmt.Sprintf("PI: %s", pi), nk.TextLeft)
+		nk.NkLabel(ctx, fmt.Sprintf("PS: %s", info.PS), nk.TextLeft)
+		var pty = ""
+		if info.Groups > 0 {
+			pty = info.PTYName
+		}
+		nk.NkLabel(ctx, fmt.Sprintf("PTY: %s", pty), nk.TextLeft)
+		var rbds = boolToInt32(rdsDecoder.IsRBDS())
+		nk.NkCheckboxLabel(ctx, "RBDS", &rbds)
+		if (rbds == 1) != rdsDecoder.IsRBDS() {
+			rdsDecoder.SetRBDS(rbds == 1)
+		}
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("RT: %s", info.RadioText), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 20, 2)
+	{
+		var clock = ""
+		if info.HasClock {
+			clock = info.ClockTime.Format("2006-01-02 15:04 -07:00")
+		}
+		nk.NkLabel(ctx, fmt.Sprintf("CT: %s", clock), nk.TextLeft)
+		var afs = make([]string, len(info.AlternativeFrequencies))
+		for i, v := range info.AlternativeFrequencies {
+			afs[i] = fmt.Sprintf("%.1f", v/1e6)
+		}
+		nk.NkLabel(ctx, fmt.Sprintf("AF: %s", strings.Join(afs, " ")), nk.TextLeft)
+	}
+}
+
+func buildRecordingMenu(ctx *nk.Context) {
+	if !IsRecording() {
+		nk.NkLayoutRowDynamic(ctx, 20, 2)
+		{
+			nk.NkLabel(ctx, "Record to", nk.TextLeft)
+			recordingDir = editText(ctx, recordingDir, 256, nk.NkFilterDefault)
+		}
+		return
+	}
+
+	recorderMtx.Lock()
+	var duration = time.Duration(0)
+	if recorder != nil {
+		duration = recorder.GetDuration()
+	}
+	recorderMtx.Unlock()
+
+	nk.NkLayoutRowDynamic(ctx, 20, 1)
+	{
+		nk.NkLabel(ctx, fmt.Sprintf("Recording IQ: %s", formatDuration(duration)), nk.TextLeft)
+	}
+	nk.NkLayoutRowDynamic(ctx, 25, 2)
+	{
+		annotationText = editText(ctx, annotationText, 128, nk.NkFilterDefault)
+		if nk.NkButtonLabel(ctx, "Annotate") > 0 && annotationText != "" {
+			AnnotateRecording(annotationText, "")
+			annotationText = ""
+		}
+	}
+}
+
 func buildFFTWindow(win *glfw.Window, ctx *nk.Context) {
 	width, height := win.GetSize()
 	nk.NkStyleSetFont(ctx, fonts["sans16"].Handle())
@@ -218,24 +1009,148 @@ func buildFFTWindow(win *glfw.Window, ctx *nk.Context) {
 	update := nk.NkBegin(ctx, "FFT Window", bounds, 0)
 	if update > 0 {
 		frequencySelector.ShowAndUpdate(ctx)
+		if demodMode == ModeWFM {
+			buildRDSPanel(ctx)
+		}
 		if isUpdated {
 			frameImg, frameTex = rgbaTex(frameTex, img)
 			isUpdated = false
 		}
 		nk.NkLayoutRowDynamic(ctx, imgHeight, 1)
 		{
+			handleSpectrumMouse(ctx, nk.NkWidgetBounds(ctx))
 			nk.NkImage(ctx, frameImg)
 		}
-		if float64(frequencySelector.GetFrequency()) != centerFreq {
-			centerFreq = float64(frequencySelector.GetFrequency())
-			if dev != nil {
-				dev.RXChannels[channel].SetCenterFrequency(centerFreq)
-			}
+		if float64(frequencySelector.GetFrequency()) != vfoFrequency {
+			SetVFOFrequency(float64(frequencySelector.GetFrequency()))
 		}
 	}
 	nk.NkEnd(ctx)
 }
 
+// region Spectrum Mouse Tuning
+
+var tuningSteps = []float64{1, 10, 100, 1e3, 5e3, 6.25e3, 25e3 / 3, 9e3, 10e3, 12.5e3, 25e3, 50e3, 100e3, 200e3}
+var selectedTuningStep = int32(12)
+
+// edgeGrabDistance is how close in pixels the mouse has to be to grab a channel edge
+const edgeGrabDistance = 5
+
+const (
+	dragNone = iota
+	dragTune
+	dragLowEdge
+	dragHighEdge
+	dragPan
+)
+
+var spectrumDrag = dragNone
+
+// panStartX and panStart are the mouse position and pan when a right button pan drag started
+var panStartX float64
+var panStart float64
+
+// tuneDragCenter and tuneDragHzPerPixel are the spectrum mapping when a tuning drag started. Dragging can retune the LO,
+// so the mapping is kept fixed, otherwise every retune moves the frequency under the mouse and the LO walks away.
+var tuneDragCenter float64
+var tuneDragHzPerPixel float64
+
+var spectrumZoomNames = "1x\x002x\x004x\x008x\x0016x\x0032x\x0064x"
+
+func tuningStepNames() []string {
+	var names = make([]string, len(tuningSteps))
+	for i, step := range tuningSteps {
+		v, unit := toNotationUnit(float32(step))
+		names[i] = fmt.Sprintf("%g %sHz", math.Round(float64(v)*100)/100, unit)
+	}
+	return names
+}
+
+func snapToStep(frequency float64) float64 {
+	var step = tuningSteps[selectedTuningStep]
+	return math.Round(frequency/step) * step
+}
+
+// handleSpectrumMouse tunes by clicking, dragging and scrolling over the spectrum and waterfall image drawn at bounds
+func handleSpectrumMouse(ctx *nk.Context, bounds nk.Rect) {
+	var in = ctx.Input()
+	var mouseX, _ = in.Mouse().Pos()
+	var x = float64(float32(mouseX)-bounds.X()) / float64(bounds.W()) * imgWidth
+	var frequency = PixelXToFrequency(x, imgWidth)
+
+	if nk.NkInputIsMouseDown(in, nk.ButtonLeft) == 0 && nk.NkInputIsMouseDown(in, nk.ButtonRight) == 0 {
+		spectrumDrag = dragNone
+	}
+
+	if nk.NkInputIsMouseHoveringRect(in, bounds) == 0 && spectrumDrag == dragNone {
+		return
+	}
+
+	if spectrumDrag == dragPan {
+		var hzPerPixel = GetVisibleSpan() / imgWidth
+		SetSpectrumPan(panStart - (x-panStartX)*hzPerPixel)
+		return
+	}
+	if spectrumDrag == dragNone && nk.NkInputIsMousePressed(in, nk.ButtonRight) > 0 {
+		spectrumDrag = dragPan
+		panStartX = x
+		panStart = GetVisibleCenter() - centerFreq
+		return
+	}
+
+	switch spectrumDrag {
+	case dragNone:
+		if nk.NkInputIsMousePressed(in, nk.ButtonLeft) > 0 {
+			var p = GetChannelParams(demodMode, demodBandwidth)
+			var scale = float64(bounds.W()) / imgWidth
+			var lowX = FrequencyToPixelX(vfoFrequency+p.LowCut, imgWidth) * scale
+			var highX = FrequencyToPixelX(vfoFrequency+p.HighCut, imgWidth) * scale
+			var mx = x * scale
+			if nk.NkInputIsKeyDown(in, nk.KeyShift) > 0 {
+				// Shift + click places a marker
+				AddMarker(frequency)
+				return
+			}
+			// Sideband modes have a fixed edge next to the carrier
+			if math.Abs(mx-lowX) <= edgeGrabDistance && demodMode != ModeUSB {
+				spectrumDrag = dragLowEdge
+			} else if math.Abs(mx-highX) <= edgeGrabDistance && demodMode != ModeLSB {
+				spectrumDrag = dragHighEdge
+			} else {
+				spectrumDrag = dragTune
+				tuneDragCenter = GetVisibleCenter()
+				tuneDragHzPerPixel = GetVisibleSpan() / imgWidth
+				SetVFOFrequency(snapToStep(frequency))
+			}
+		}
+		var scroll = in.Mouse().ScrollDelta()
+		if nk.NkInputIsKeyDown(in, nk.KeyCtrl) > 0 {
+			// Ctrl + wheel zooms around the mouse
+			if scroll.Y() > 0 {
+				SetSpectrumZoom(spectrumZoom*2, frequency)
+			} else if scroll.Y() < 0 {
+				SetSpectrumZoom(spectrumZoom/2, frequency)
+			}
+		} else if scroll.Y() > 0 {
+			SetVFOFrequency(snapToStep(vfoFrequency) + tuningSteps[selectedTuningStep])
+		} else if scroll.Y() < 0 {
+			SetVFOFrequency(snapToStep(vfoFrequency) - tuningSteps[selectedTuningStep])
+		}
+	case dragTune:
+		frequency = tuneDragCenter + (x-imgWidth/2)*tuneDragHzPerPixel
+		if snapToStep(frequency) != vfoFrequency {
+			SetVFOFrequency(snapToStep(frequency))
+		}
+	case dragLowEdge, dragHighEdge:
+		var bandwidth = BandwidthFromEdge(demodMode, frequency-vfoFrequency)
+		if bandwidth != demodBandwidth {
+			SetDemodBandwidth(bandwidth)
+		}
+	}
+}
+
+// endregion
+
 func DrawLoading(win *glfw.Window, ctx *nk.Context) {
 	ww, wh := win.GetSize()
 	width := float32(600)
@@ -266,10 +1181,18 @@ func DrawLoading(win *glfw.Window, ctx *nk.Context) {
 				nk.NkLabel(ctx, dspLoadError, nk.TextAlignCentered|nk.TextAlignMiddle)
 				nk.NkStyleSetFont(ctx, fonts["sans16"].Handle())
 			}
-			nk.NkLayoutRowStatic(ctx, resultH-70-pad.Y()*2, int32(resultW), 1)
+			// The generator always opens, so the other sources can be picked from the side menu
+			nk.NkLayoutRowDynamic(ctx, resultH-70-pad.Y()*2, 2)
 			{
 				if nk.NkButtonLabel(ctx, "Try Again") > 0 {
-					go InitializeLimeSDR()
+					go InitializeDSP()
+				}
+				if nk.NkButtonLabel(ctx, "Use Signal Generator") > 0 {
+					selectedSourceType = sourceTypeGenerator
+					sourceFactory = func() SampleSource {
+						return MakeGeneratorSource(defaultSettings().SampleRate, centerFreq)
+					}
+					go InitializeDSP()
 				}
 			}
 		}
@@ -287,6 +1210,7 @@ func gfxMain(win *glfw.Window, ctx *nk.Context, state *UIState) {
 	} else {
 		buildSideMenu(win, ctx)
 		buildFFTWindow(win, ctx)
+		autoSaveSettings()
 	}
 
 	// Render
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+)
+
+// vfoUsableSpan is the fraction of the captured bandwidth the VFO can use, the edges are attenuated by the anti-alias filters
+const vfoUsableSpan = 0.9
+
+// vfoDCGuard is how close to the LO a channel can get before offset tuning moves the LO away
+const vfoDCGuard = 10e3
+
+// vfoFrequency is the frequency being demodulated, it can be anywhere inside the captured span
+var vfoFrequency float64
+var vfoShifter = makeFrequencyShifter(0, 1)
+
+// offsetTuning retunes the LO away from the VFO, so the DC spike does not land on the signal
+var offsetTuning = true
+
+func GetVFOFrequency() float64 {
+	return vfoFrequency
+}
+
+// GetVFOOffset returns the VFO frequency relative to the LO
+func GetVFOOffset() float64 {
+	return vfoFrequency - centerFreq
+}
+
+// SetVFOFrequency tunes the demodulator to frequency. The LO is only retuned when the channel does not fit in the captured span.
+func SetVFOFrequency(frequency float64) {
+	var p = GetChannelParams(demodMode, demodBandwidth)
+	var halfSpan = sampleRate / 2 * vfoUsableSpan
+	var offset = frequency - centerFreq
+
+	if !canRetune() {
+		// Nothing outside the recording can be heard, keep the channel inside of it
+		offset = math.Max(offset, -halfSpan-p.LowCut)
+		offset = math.Min(offset, halfSpan-p.HighCut)
+		setVFO(centerFreq + offset)
+		return
+	}
+
+	var outside = offset+p.LowCut < -halfSpan || offset+p.HighCut > halfSpan
+	var onDC = offsetTuning && offset+p.LowCut < vfoDCGuard && offset+p.HighCut > -vfoDCGuard
+	if outside || onDC {
+		SetCenterFrequency(frequency - loOffset(p))
+	}
+	setVFO(frequency)
+}
+
+func SetOffsetTuning(enabled bool) {
+	offsetTuning = enabled
+	SetVFOFrequency(vfoFrequency)
+}
+
+// canRetune tells if the source LO can be moved. Recordings and the generator only relabel their samples.
+func canRetune() bool {
+	switch source.(type) {
+	case *FileSource, *GeneratorSource:
+		return false
+	}
+	return source != nil
+}
+
+// loOffset is where the LO goes relative to the VFO when it needs to be retuned
+func loOffset(p ChannelParams) float64 {
+	if !offsetTuning {
+		return 0
+	}
+	var offset = sampleRate / 4
+	if offset+p.HighCut > sampleRate/2*vfoUsableSpan || offset+p.LowCut < vfoDCGuard {
+		// Channel too wide to be moved away from DC
+		return 0
+	}
+	return offset
+}
+
+func setVFO(frequency float64) {
+	frequency = math.Round(frequency)
+	if frequency != vfoFrequency {
+		rdsDecoder.Reset()
+	}
+	vfoFrequency = frequency
+	frequencySelector.SetFrequency(uint32(frequency))
+	ShowFrequency(frequency)
+	updateVFO()
+}
+
+// keepVFOInSpan recenters the VFO when the LO or sample rate changes leave it out of the captured span
+func keepVFOInSpan() {
+	var p = GetChannelParams(demodMode, demodBandwidth)
+	var halfSpan = sampleRate / 2 * vfoUsableSpan
+	var offset = GetVFOOffset()
+	if offset+p.LowCut < -halfSpan || offset+p.HighCut > halfSpan {
+		// The LO was just chosen, so the channel goes where offset tuning would have put it instead of on the DC spike
+		if canRetune() {
+			setVFO(centerFreq + loOffset(p))
+		} else {
+			setVFO(centerFreq)
+		}
+	} else {
+		updateVFO()
+	}
+}
+
+func updateVFO() {
+	samplesMtx.Lock()
+	defer samplesMtx.Unlock()
+	vfoShifter.SetFrequency(centerFreq-vfoFrequency, sampleRate)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// waterfallHistorySize is how many lines are kept for scrollback and export
+const waterfallHistorySize = 3600
+
+// waterfallMaxBins limits the memory used by the history, wider spectra keep the strongest bin of each group
+const waterfallMaxBins = 4096
+
+// waterfallTickSpacing is the distance in lines between time labels
+const waterfallTickSpacing = 64
+
+var waterFallBuffers = make([]*image.RGBA, wtfHeight)
+
+// waterfallRow is a power spectrum kept to redraw the waterfall when the view changes
+type waterfallRow struct {
+	spectrum        []float32
+	centerFrequency float64
+	sampleRate      float64
+	time            time.Time
+}
+
+// waterfallView holds everything that changes how the waterfall rows are rendered
+type waterfallView struct {
+	start      float64
+	span       float64
+	minVisible float64
+	maxVisible float64
+	palette    int32
+	scroll     int
+}
+
+// waterfallRows is the history, newest line first
+var waterfallRows = make([]waterfallRow, 0, waterfallHistorySize)
+var lastWaterfallView waterfallView
+
+// lastSpectrumRow is the latest averaged spectrum at full resolution
+var lastSpectrumRow waterfallRow
+
+// waterfallLineRate is how many lines per second the waterfall advances, independent of the frame rate
+var waterfallLineRate = float32(30)
+
+// waterfallScroll is how many lines back in the history the waterfall is showing
+var waterfallScroll = 0
+
+var lastWaterfallLine = time.Now()
+var pendingRow waterfallRow
+var pendingCount = 0
+
+func currentWaterfallView() waterfallView {
+	return waterfallView{
+		start:      PixelXToFrequency(0, imgWidth),
+		span:       GetVisibleSpan(),
+		maxVisible: float64(waterfallMax),
+		minVisible: float64(waterfallMin),
+		palette:    selectedPalette,
+		scroll:     waterfallScroll,
+	}
+}
+
+func renderWaterfallLine(row waterfallRow, view waterfallView) *image.RGBA {
+	var line = image.NewRGBA(image.Rect(0, 0, imgWidth, 1))
+	var scale = 256 / (view.maxVisible - view.minVisible)
+	for x, s := range spectrumPixels(row, imgWidth) {
+		if math.IsNaN(float64(s)) {
+			line.Set(x, 0, waterFallLut[0])
+			continue
+		}
+		var waterFallZ = (float64(s) - view.minVisible) * scale
+		if waterFallZ > 255 {
+			waterFallZ = 255
+		} else if waterFallZ < 0 {
+			waterFallZ = 0
+		}
+		line.Set(x, 0, waterFallLut[uint8(waterFallZ)])
+	}
+	return line
+}
+
+// decimateSpectrum keeps the strongest bin of each group so the spectrum has at most waterfallMaxBins
+func decimateSpectrum(spectrum []float32) []float32 {
+	if len(spectrum) <= waterfallMaxBins {
+		return spectrum
+	}
+	var group = len(spectrum) / waterfallMaxBins
+	var out = make([]float32, len(spectrum)/group)
+	for i := range out {
+		out[i] = spectrum[i*group]
+		for _, v := range spectrum[i*group+1 : (i+1)*group] {
+			if v > out[i] {
+				out[i] = v
+			}
+		}
+	}
+	return out
+}
+
+// updateWaterfall averages the spectra between lines, adds a line at the line rate and renders what is visible
+func updateWaterfall(row waterfallRow, view waterfallView) {
+	if pendingCount == 0 || len(pendingRow.spectrum) != len(row.spectrum) ||
+		pendingRow.centerFrequency != row.centerFrequency || pendingRow.sampleRate != row.sampleRate {
+		pendingRow = row
+		pendingRow.spectrum = append([]float32(nil), row.spectrum...)
+		pendingCount = 1
+	} else {
+		for i, v := range row.spectrum {
+			pendingRow.spectrum[i] += v
+		}
+		pendingCount++
+	}
+
+	var added = false
+	var interval = time.Duration(float64(time.Second) / float64(waterfallLineRate))
+	if time.Since(lastWaterfallLine) >= interval {
+		lastWaterfallLine = lastWaterfallLine.Add(interval)
+		if time.Since(lastWaterfallLine) > interval {
+			// Too far behind, do not try to catch up
+			lastWaterfallLine = time.Now()
+		}
+
+		for i := range pendingRow.spectrum {
+			pendingRow.spectrum[i] /= float32(pendingCount)
+		}
+		pendingRow.spectrum = decimateSpectrum(pendingRow.spectrum)
+		pendingRow.time = time.Now()
+		pendingCount = 0
+
+		var keep = len(waterfallRows)
+		if keep > waterfallHistorySize-1 {
+			keep = waterfallHistorySize - 1
+		}
+		waterfallRows = append([]waterfallRow{pendingRow}, waterfallRows[:keep]...)
+		added = true
+
+		// Keep showing the same lines when scrolled back
+		if waterfallScroll > 0 {
+			waterfallScroll = int(math.Min(float64(waterfallScroll+1), float64(maxWaterfallScroll())))
+			view.scroll = waterfallScroll
+			lastWaterfallView.scroll = waterfallScroll
+		}
+	}
+
+	if view != lastWaterfallView {
+		lastWaterfallView = view
+		for i := range waterFallBuffers {
+			waterFallBuffers[i] = nil
+			if i+view.scroll < len(waterfallRows) {
+				waterFallBuffers[i] = renderWaterfallLine(waterfallRows[i+view.scroll], view)
+			}
+		}
+		return
+	}
+
+	if added && view.scroll == 0 {
+		// Shift the waterfall forward, and add current as first.
+		waterFallBuffers = append([]*image.RGBA{renderWaterfallLine(waterfallRows[0], view)}, waterFallBuffers[:wtfHeight-1]...)
+	}
+}
+
+func maxWaterfallScroll() int {
+	return int(math.Max(0, float64(len(waterfallRows)-wtfHeight)))
+}
+
+func SetWaterfallScroll(scroll int) {
+	waterfallScroll = int(math.Max(0, math.Min(float64(scroll), float64(maxWaterfallScroll()))))
+}
+
+// GetWaterfallDuration returns the time covered by the history
+func GetWaterfallDuration() time.Duration {
+	if len(waterfallRows) == 0 {
+		return 0
+	}
+	return waterfallRows[0].time.Sub(waterfallRows[len(waterfallRows)-1].time)
+}
+
+func drawWaterfallTimeTicks(gc *draw2dimg.GraphicContext, img *image.RGBA) {
+	gc.Save()
+	gc.SetFontSize(10)
+	gc.SetFillColor(color.NRGBA{R: 200, G: 200, B: 200, A: 255})
+	for y := 0; y < wtfHeight; y += waterfallTickSpacing {
+		var i = y + waterfallScroll
+		if i >= len(waterfallRows) {
+			break
+		}
+		DrawLine(0, float32(fftHeight+y), 8, float32(fftHeight+y), color.NRGBA{R: 200, G: 200, B: 200, A: 255}, img)
+		gc.FillStringAt(waterfallRows[i].time.Format("15:04:05"), 10, float64(fftHeight+y)+10)
+	}
+	gc.Restore()
+}
+
+// ExportWaterfall saves the whole history as a PNG with the current zoom, levels and palette, returning the file name
+func ExportWaterfall(dir string) (string, error) {
+	if len(waterfallRows) == 0 {
+		return "", fmt.Errorf("the waterfall is empty")
+	}
+
+	const leftMargin = 64
+	const topMargin = 24
+	var out = image.NewRGBA(image.Rect(0, 0, imgWidth+leftMargin, topMargin+len(waterfallRows)))
+	draw.Draw(out, out.Bounds(), &image.Uniform{C: color.NRGBA{A: 255}}, image.ZP, draw.Src)
+
+	var view = currentWaterfallView()
+	for i, row := range waterfallRows {
+		var line = renderWaterfallLine(row, view)
+		draw.Draw(out, image.Rect(leftMargin, topMargin+i, leftMargin+imgWidth, topMargin+i+1), line, image.ZP, draw.Src)
+	}
+
+	var egc = draw2dimg.NewGraphicContext(out)
+	egc.SetFontData(draw2d.FontData{
+		Name:   "FreeMono",
+		Family: draw2d.FontFamilyMono,
+		Style:  draw2d.FontStyleNormal,
+	})
+	egc.SetFontSize(10)
+	egc.SetFillColor(color.NRGBA{R: 200, G: 200, B: 200, A: 255})
+	var axisColor = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+
+	// Frequency axis
+	var startFreq = PixelXToFrequency(0, imgWidth)
+	var span = GetVisibleSpan()
+	var step = niceGridStep(span / vGridSteps)
+	for v := math.Ceil(startFreq/step) * step; v < startFreq+span; v += step {
+		var x = float32(leftMargin + math.Round(FrequencyToPixelX(v, imgWidth)))
+		DrawLine(x, topMargin-6, x, topMargin, axisColor, out)
+		egc.FillStringAt(formatAxisFrequency(v, step), float64(x)+3, topMargin-8)
+	}
+
+	// Time axis
+	for i := 0; i < len(waterfallRows); i += waterfallTickSpacing {
+		var y = float32(topMargin + i)
+		DrawLine(leftMargin-6, y, leftMargin, y, axisColor, out)
+		egc.FillStringAt(waterfallRows[i].time.Format("15:04:05"), 4, float64(y)+4)
+	}
+
+	var name = filepath.Join(dir, fmt.Sprintf("segdsp-waterfall-%s.png", time.Now().Format("20060102-150405")))
+	f, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return name, png.Encode(f, out)
+}
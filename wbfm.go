@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const wbfmDeviation = 75e3
+const wbfmPilotFrequency = 19e3
+const wbfmAudioCut = 15e3
+
+// De-emphasis time constants
+const (
+	deemphasis50us = 50e-6
+	deemphasis75us = 75e-6
+)
+
+// StereoDemodData is returned by demodulators that output two audio channels
+type StereoDemodData struct {
+	Left   []float32
+	Right  []float32
+	Stereo bool
+	// RDSBits are the data bits decoded from the RDS subcarrier
+	RDSBits []uint8
+}
+
+// region Pilot PLL
+
+// pilotPLL locks to the 19 kHz stereo pilot, giving the phase used to demodulate the 38 kHz (and 57 kHz RDS) subcarriers
+type pilotPLL struct {
+	phase     float64
+	frequency float64
+	minFreq   float64
+	maxFreq   float64
+	alpha     float64
+	beta      float64
+
+	avg      complex128
+	avgCoeff float64
+	level    float64
+	locked   bool
+}
+
+func makePilotPLL(sampleRate float64) *pilotPLL {
+	var wn = 2 * math.Pi * 20 / sampleRate // 20 Hz loop bandwidth
+	var damping = math.Sqrt2 / 2
+	var center = 2 * math.Pi * wbfmPilotFrequency / sampleRate
+	var maxDelta = 2 * math.Pi * 50 / sampleRate
+	return &pilotPLL{
+		frequency: center,
+		minFreq:   center - maxDelta,
+		maxFreq:   center + maxDelta,
+		alpha:     2 * damping * wn,
+		beta:      wn * wn,
+		avgCoeff:  1 - math.Exp(-2*math.Pi*200/sampleRate),
+	}
+}
+
+// Work returns the pilot phase for each mpx sample. The pilot is sin(phase).
+func (p *pilotPLL) Work(mpx []float32) []float64 {
+	var phases = make([]float64, len(mpx))
+	for i, v := range mpx {
+		phases[i] = p.phase
+
+		var sin, cos = math.Sincos(p.phase)
+		var z = complex(float64(v)*cos, -float64(v)*sin)
+		p.avg += (z - p.avg) * complex(p.avgCoeff, 0)
+
+		// sin(x) mixed with exp(-j*phase) gives -j/2 * exp(j*(x - phase)), rotate it back by j
+		var err = cmplx.Phase(p.avg * 1i)
+
+		p.frequency += p.beta * err
+		if p.frequency < p.minFreq {
+			p.frequency = p.minFreq
+		} else if p.frequency > p.maxFreq {
+			p.frequency = p.maxFreq
+		}
+		p.phase = math.Mod(p.phase+p.frequency+p.alpha*err, 2*math.Pi)
+	}
+
+	// Pilot at the standard 10% injection gives a level close to 0.05
+	p.level = cmplx.Abs(p.avg)
+	if p.locked && p.level < 0.01 {
+		p.locked = false
+	} else if !p.locked && p.level > 0.02 {
+		p.locked = true
+	}
+
+	return phases
+}
+
+// endregion
+
+type wbfmDemodulator struct {
+	params     ChannelParams
+	sampleRate float64
+	mpxRate    float64
+	forceMono  bool
+
+	decimator   *complexFirFilter
+	quad        *quadDemod
+	pll         *pilotPLL
+	rds         *rdsDemodulator
+	sumFilter   *floatFirFilter
+	diffFilter  *floatFirFilter
+	leftDeemph  *deemphasisFilter
+	rightDeemph *deemphasisFilter
+	leftResamp  *audioResampler
+	rightResamp *audioResampler
+}
+
+func makeWBFMDemodulator(sampleRate, bandwidth, deemphasisTau float64, forceMono bool) *wbfmDemodulator {
+	var decimation = int(math.Max(1, math.Floor(sampleRate/250e3)))
+	var mpxRate = sampleRate / float64(decimation)
+	var cut = math.Min(bandwidth/2, mpxRate*0.45)
+	var transition = math.Max(mpxRate/2-cut, 10e3)
+	var audioTaps = makeLowPassTaps(1, mpxRate, wbfmAudioCut, 4e3)
+
+	var d = &wbfmDemodulator{
+		params:      GetChannelParams(ModeWFM, bandwidth),
+		sampleRate:  sampleRate,
+		mpxRate:     mpxRate,
+		forceMono:   forceMono,
+		decimator:   makeComplexFirFilter(makeLowPassTaps(1, sampleRate, cut, transition), decimation),
+		quad:        makeQuadDemod(float32(mpxRate / (2 * math.Pi * wbfmDeviation))),
+		pll:         makePilotPLL(mpxRate),
+		sumFilter:   makeFloatFirFilter(audioTaps, 1),
+		diffFilter:  makeFloatFirFilter(audioTaps, 1),
+		leftDeemph:  makeDeemphasisFilter(deemphasisTau, mpxRate),
+		rightDeemph: makeDeemphasisFilter(deemphasisTau, mpxRate),
+		leftResamp:  makeAudioResampler(mpxRate, audioSampleRate),
+		rightResamp: makeAudioResampler(mpxRate, audioSampleRate),
+	}
+
+	if mpxRate >= rdsMinMpxRate {
+		d.rds = makeRDSDemodulator(mpxRate)
+	}
+
+	return d
+}
+
+func (d *wbfmDemodulator) GetDemodParams() interface{} {
+	return d.params
+}
+
+func (d *wbfmDemodulator) IsStereo() bool {
+	return !d.forceMono && d.pll.locked
+}
+
+func (d *wbfmDemodulator) Work(data []complex64) interface{} {
+	var iq = d.decimator.Work(data)
+	var mpx = d.quad.Work(iq)
+	var phases = d.pll.Work(mpx)
+
+	var rdsBits []uint8
+	if d.rds != nil {
+		rdsBits = d.rds.Work(mpx, phases)
+	}
+
+	// (L-R)/2 is on a suppressed 38 kHz carrier, sin(2 * pilot phase)
+	var diff = make([]float32, len(mpx))
+	for i, v := range mpx {
+		diff[i] = v * float32(2*math.Sin(2*phases[i]))
+	}
+
+	var sum = d.sumFilter.Work(mpx)
+	diff = d.diffFilter.Work(diff)
+
+	var stereo = d.IsStereo()
+	var left = make([]float32, len(sum))
+	var right = make([]float32, len(sum))
+	for i := range sum {
+		if stereo {
+			left[i] = sum[i] + diff[i]
+			right[i] = sum[i] - diff[i]
+		} else {
+			left[i] = sum[i]
+			right[i] = sum[i]
+		}
+	}
+
+	left = d.leftResamp.Work(d.leftDeemph.Work(left))
+	right = d.rightResamp.Work(d.rightDeemph.Work(right))
+
+	return StereoDemodData{
+		Left:    left,
+		Right:   right,
+		Stereo:  stereo,
+		RDSBits: rdsBits,
+	}
+}